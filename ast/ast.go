@@ -1,7 +1,11 @@
 package ast
 
 import (
+	"fmt"
 	"github.com/jonfk/calc/lex"
+	"math"
+	"math/big"
+	"strconv"
 	"strings"
 	"unicode"
 	"unicode/utf8"
@@ -126,6 +130,41 @@ func (g *CommentGroup) Text() string {
 	return strings.Join(lines, "\n")
 }
 
+// ----------------------------------------------------------------------------
+// Fields
+
+// A Field represents a parameter in a function signature.
+type Field struct {
+	Name *Ident // parameter name
+	Type Expr   // parameter type; or nil
+}
+
+func (f *Field) Pos() lex.Pos { return f.Name.Pos() }
+func (f *Field) End() lex.Pos {
+	if f.Type != nil {
+		return f.Type.End()
+	}
+	return f.Name.End()
+}
+
+// A FieldList represents a list of Fields, enclosed by parentheses.
+type FieldList struct {
+	Opening lex.Token // position of opening parenthesis
+	List    []*Field  // field list; or nil
+	Closing lex.Token // position of closing parenthesis
+}
+
+func (f *FieldList) Pos() lex.Pos { return f.Opening.Pos }
+func (f *FieldList) End() lex.Pos { return f.Closing.Pos + 1 }
+
+// NumFields returns the number of parameters in a FieldList.
+func (f *FieldList) NumFields() int {
+	if f != nil {
+		return len(f.List)
+	}
+	return 0
+}
+
 // ---------------------------------------------------------------
 // Expressions
 
@@ -149,7 +188,7 @@ type (
 
 	// A BasicLit node represents a literal of basic type.
 	BasicLit struct {
-		Tok lex.Token // token.INT, token.FLOAT, not supported yet: token.CHAR, or token.STRING
+		Tok lex.Token // token.INT, token.FLOAT, token.STRING or token.CHAR
 	}
 
 	// A ParenExpr node represents a parenthesized expression.
@@ -159,6 +198,14 @@ type (
 		Rparen lex.Token // position of ")"
 	}
 
+	// A TupleExpr node represents a parenthesized list of two or more
+	// expressions separated by commas.
+	TupleExpr struct {
+		Lparen lex.Token // position of "("
+		Elts   []Expr    // list of elements
+		Rparen lex.Token // position of ")"
+	}
+
 	// A UnaryExpr node represents a unary expression.
 	UnaryExpr struct {
 		Op lex.Token // operator
@@ -189,6 +236,33 @@ type (
 		Else   *BlockExpr
 		EndTok lex.Token
 	}
+
+	// A LetExpr node represents a let expression. The names
+	// declared by Decls are in scope only in Body.
+	LetExpr struct {
+		Let    lex.Token
+		Decls  []Decl // val or var declarations
+		Body   *BlockExpr
+		EndTok lex.Token
+	}
+
+	// A FuncLit node represents a function literal.
+	FuncLit struct {
+		Fn     lex.Token  // "fn" keyword
+		Params *FieldList // parameters
+		Result Expr       // result type; or nil
+		Arrow  lex.Token  // "=>" token
+		Body   *BlockExpr // function body
+		EndTok lex.Token
+	}
+
+	// A CallExpr node represents an expression followed by an argument list.
+	CallExpr struct {
+		Fun    Expr      // function expression
+		Lparen lex.Token // position of "("
+		Args   []Expr    // function arguments; or nil
+		Rparen lex.Token // position of ")"
+	}
 )
 
 // Pos and End implementations for expression/type nodes.
@@ -197,19 +271,27 @@ func (x *BadExpr) Pos() lex.Pos    { return x.From }
 func (x *Ident) Pos() lex.Pos      { return x.Tok.Pos }
 func (x *BasicLit) Pos() lex.Pos   { return x.Tok.Pos }
 func (x *ParenExpr) Pos() lex.Pos  { return x.Lparen.Pos }
+func (x *TupleExpr) Pos() lex.Pos  { return x.Lparen.Pos }
 func (x *UnaryExpr) Pos() lex.Pos  { return x.Op.Pos }
 func (x *BinaryExpr) Pos() lex.Pos { return x.X.Pos() }
 func (x *BlockExpr) Pos() lex.Pos  { return x.StartPos }
 func (x *IfExpr) Pos() lex.Pos     { return x.If.Pos }
+func (x *LetExpr) Pos() lex.Pos    { return x.Let.Pos }
+func (x *FuncLit) Pos() lex.Pos    { return x.Fn.Pos }
+func (x *CallExpr) Pos() lex.Pos   { return x.Fun.Pos() }
 
 func (x *BadExpr) End() lex.Pos    { return x.To }
 func (x *Ident) End() lex.Pos      { return lex.Pos(int(x.Tok.Pos) + len(x.Tok.Val)) }
 func (x *BasicLit) End() lex.Pos   { return lex.Pos(int(x.Tok.Pos) + len(x.Tok.Val)) }
 func (x *ParenExpr) End() lex.Pos  { return x.Rparen.Pos + 1 }
+func (x *TupleExpr) End() lex.Pos  { return x.Rparen.Pos + 1 }
 func (x *UnaryExpr) End() lex.Pos  { return x.X.End() }
 func (x *BinaryExpr) End() lex.Pos { return x.Y.End() }
 func (x *BlockExpr) End() lex.Pos  { return x.EndPos }
-func (x *IfExpr) End() lex.Pos     { return x.EndTok.Pos }
+func (x *IfExpr) End() lex.Pos     { return lex.Pos(int(x.EndTok.Pos) + len(x.EndTok.Val)) }
+func (x *LetExpr) End() lex.Pos    { return lex.Pos(int(x.EndTok.Pos) + len(x.EndTok.Val)) }
+func (x *FuncLit) End() lex.Pos    { return lex.Pos(int(x.EndTok.Pos) + len(x.EndTok.Val)) }
+func (x *CallExpr) End() lex.Pos   { return x.Rparen.Pos + 1 }
 
 // exprNode() ensures that only expression/type nodes can be
 // assigned to an ExprNode.
@@ -218,9 +300,14 @@ func (*BadExpr) exprNode()    {}
 func (*Ident) exprNode()      {}
 func (*BasicLit) exprNode()   {}
 func (*ParenExpr) exprNode()  {}
+func (*TupleExpr) exprNode()  {}
 func (*UnaryExpr) exprNode()  {}
 func (*BinaryExpr) exprNode() {}
 func (*BlockExpr) exprNode()  {}
+func (*IfExpr) exprNode()     {}
+func (*LetExpr) exprNode()    {}
+func (*FuncLit) exprNode()    {}
+func (*CallExpr) exprNode()   {}
 
 // ----------------------------------------------------------------------------
 // Convenience functions for Idents
@@ -228,7 +315,9 @@ func (*BlockExpr) exprNode()  {}
 // NewIdent creates a new Ident without position.
 // Useful for ASTs generated by code other than the Go parser.
 //
-func NewIdent(name string) *Ident { return &Ident{lex.Token{lex.IDENTIFIER, lex.NoPos, name}, nil} }
+func NewIdent(name string) *Ident {
+	return &Ident{Tok: lex.Token{Typ: lex.IDENTIFIER, Pos: lex.NoPos, Val: name}}
+}
 
 // IsExported reports whether name is an exported Go symbol
 // (that is, whether it begins with an upper-case letter).
@@ -243,6 +332,151 @@ func IsExported(name string) bool {
 //
 func (id *Ident) IsExported() bool { return IsExported(id.Tok.Val) }
 
+// ----------------------------------------------------------------------------
+// Convenience functions for BasicLits
+
+// StringValue returns the value of a STRING literal, without its
+// quotes and with its escape sequences decoded.
+//
+func (x *BasicLit) StringValue() (string, error) {
+	if x.Tok.Typ != lex.STRING {
+		return "", fmt.Errorf("%s is not a string literal", x.Tok)
+	}
+	return strconv.Unquote(x.Tok.Val)
+}
+
+// IntValue returns the value of an INT literal. The literal may have
+// a 0x, 0c (octal) or 0b prefix and underscores between its digits;
+// without a prefix it is decimal, even with leading zeros. The error
+// is strconv.ErrRange if the value does not fit in an int64 and
+// strconv.ErrSyntax if the literal is malformed.
+//
+func (x *BasicLit) IntValue() (int64, error) {
+	if x.Tok.Typ != lex.INT {
+		return 0, fmt.Errorf("%s is not an integer literal", x.Tok)
+	}
+	digits, base := x.intDigits()
+	i, err := strconv.ParseInt(digits, base, 64)
+	if err != nil {
+		return 0, err.(*strconv.NumError).Err
+	}
+	return i, nil
+}
+
+// BigIntValue returns the value of an INT literal of any size.
+// See IntValue for the syntax of the literal.
+//
+func (x *BasicLit) BigIntValue() (*big.Int, error) {
+	if x.Tok.Typ != lex.INT {
+		return nil, fmt.Errorf("%s is not an integer literal", x.Tok)
+	}
+	digits, base := x.intDigits()
+	i, ok := new(big.Int).SetString(digits, base)
+	if !ok || digits == "" || digits[0] == '+' || digits[0] == '-' {
+		return nil, strconv.ErrSyntax
+	}
+	return i, nil
+}
+
+// ImagValue returns the imaginary part of an IMAG literal: 2.5 for
+// 2.5i. The part is written as an INT or a FLOAT literal. The error is
+// strconv.ErrRange if it does not fit in a float64 and strconv.ErrSyntax
+// if the literal is malformed.
+//
+func (x *BasicLit) ImagValue() (float64, error) {
+	if x.Tok.Typ != lex.IMAG {
+		return 0, fmt.Errorf("%s is not an imaginary literal", x.Tok)
+	}
+	part := x.imagPart()
+	if part.Tok.Typ == lex.INT {
+		i, err := part.BigIntValue()
+		if err != nil {
+			return 0, err
+		}
+		f, _ := new(big.Float).SetInt(i).Float64()
+		if math.IsInf(f, 0) {
+			return 0, strconv.ErrRange
+		}
+		return f, nil
+	}
+	f, err := strconv.ParseFloat(part.Tok.Val, 64)
+	if err != nil {
+		return 0, err.(*strconv.NumError).Err
+	}
+	return f, nil
+}
+
+// imagPart returns the INT or FLOAT literal of the imaginary part of
+// an IMAG literal.
+func (x *BasicLit) imagPart() *BasicLit {
+	part := x.Tok
+	part.Val = strings.TrimSuffix(part.Val, "i")
+	part.Typ = lex.FLOAT
+	if s := strings.ToLower(part.Val); !strings.ContainsAny(s, ".e") || strings.HasPrefix(s, "0x") {
+		part.Typ = lex.INT
+	}
+	return &BasicLit{Tok: part}
+}
+
+// intDigits returns the digits of an INT literal without its base
+// prefix and underscores, and the base they are written in.
+func (x *BasicLit) intDigits() (digits string, base int) {
+	s, base := strings.ToLower(x.Tok.Val), 10
+	if len(s) >= 2 && s[0] == '0' {
+		switch s[1] {
+		case 'x':
+			s, base = s[2:], 16
+		case 'c':
+			s, base = s[2:], 8
+		case 'b':
+			s, base = s[2:], 2
+		}
+	}
+	return strings.Replace(s, "_", "", -1), base
+}
+
+// CharValue returns the character denoted by a CHAR literal.
+//
+func (x *BasicLit) CharValue() (rune, error) {
+	if x.Tok.Typ != lex.CHAR {
+		return 0, fmt.Errorf("%s is not a character literal", x.Tok)
+	}
+	if len(x.Tok.Val) < 3 {
+		return 0, strconv.ErrSyntax
+	}
+	r, _, tail, err := strconv.UnquoteChar(x.Tok.Val[1:len(x.Tok.Val)-1], '\'')
+	if err == nil && tail != "" {
+		err = strconv.ErrSyntax
+	}
+	return r, err
+}
+
+// Canonical returns the canonical spelling of the literal. Number
+// literals are lower-cased, a trailing decimal point is followed by a
+// 0 and a + sign in an exponent is dropped, so that 0X1F becomes 0x1f
+// and 3.E+2 becomes 3.0e2. Other literals are returned unchanged.
+//
+func (x *BasicLit) Canonical() string {
+	switch x.Tok.Typ {
+	case lex.IMAG:
+		return x.imagPart().Canonical() + "i"
+	case lex.INT:
+		return strings.ToLower(x.Tok.Val)
+	case lex.FLOAT:
+		s := strings.ToLower(x.Tok.Val)
+		mant, exp := s, ""
+		if i := strings.IndexByte(s, 'e'); i >= 0 {
+			mant, exp = s[:i], s[i:]
+			exp = strings.Replace(exp, "+", "", 1)
+		}
+		if strings.HasSuffix(mant, ".") {
+			mant += "0"
+		}
+		return mant + exp
+	}
+	return x.Tok.Val
+}
+
 // ----------------------------------------------------------------------------
 // Statements
 
@@ -322,14 +556,20 @@ type (
 	//
 	ValueSpec struct {
 		Doc     *CommentGroup // associated documentation; or nil
-		Name    *Ident        // value names (len(Names) > 0)
-		Type    Expr          // value type; or nil, !!!not used yet!!!
+		Name    *Ident        // value name; or nil if Pattern is set
+		Pattern *TupleExpr    // tuple of names and nested tuples; or nil
+		Type    Expr          // declared type; or nil
 		Value   Expr          // initial values; or nil
 		Comment *CommentGroup // line comments; or nil
 	}
 )
 
-func (s *ValueSpec) Pos() lex.Pos { return s.Name.Pos() }
+func (s *ValueSpec) Pos() lex.Pos {
+	if s.Pattern != nil {
+		return s.Pattern.Pos()
+	}
+	return s.Name.Pos()
+}
 func (s *ValueSpec) End() lex.Pos {
 	if s.Value != nil {
 		return s.Value.End()
@@ -337,8 +577,32 @@ func (s *ValueSpec) End() lex.Pos {
 	if s.Type != nil {
 		return s.Type.End()
 	}
+	if s.Pattern != nil {
+		return s.Pattern.End()
+	}
 	return s.Name.End()
 }
+
+// Names returns the names declared by s in the order they appear.
+func (s *ValueSpec) Names() []*Ident {
+	if s.Pattern == nil {
+		return []*Ident{s.Name}
+	}
+	var names []*Ident
+	var collect func(t *TupleExpr)
+	collect = func(t *TupleExpr) {
+		for _, x := range t.Elts {
+			switch x := x.(type) {
+			case *Ident:
+				names = append(names, x)
+			case *TupleExpr:
+				collect(x)
+			}
+		}
+	}
+	collect(s.Pattern)
+	return names
+}
 func (*ValueSpec) specNode() {}
 
 // A declaration is represented by one of the following declaration nodes.
@@ -352,18 +616,25 @@ type (
 	}
 
 	// A FuncDecl node represents a function declaration.
-	// FuncDecl struct {
-	// 	Doc  *CommentGroup // associated documentation; or nil
-	// 	Recv *FieldList    // receiver (methods); or nil (functions)
-	// 	Name *Ident        // function/method name
-	// 	Type *FuncType     // function signature: parameters, results, and position of "func" keyword
-	// 	Body *BlockStmt    // function body; or nil (forward declaration)
-	// }
+	FuncDecl struct {
+		Doc    *CommentGroup // associated documentation; or nil
+		Def    lex.Token     // "def" keyword
+		Name   *Ident        // function name
+		Params *FieldList    // parameters
+		Result Expr          // result type; or nil
+		Body   *BlockExpr    // function body
+		EndTok lex.Token
+	}
 )
 
-func (d *GenDecl) Pos() lex.Pos { return d.Tok.Pos }
-func (d *GenDecl) End() lex.Pos { return d.Spec.End() }
-func (d *GenDecl) declNode()    {}
+func (d *GenDecl) Pos() lex.Pos  { return d.Tok.Pos }
+func (d *FuncDecl) Pos() lex.Pos { return d.Def.Pos }
+
+func (d *GenDecl) End() lex.Pos  { return d.Spec.End() }
+func (d *FuncDecl) End() lex.Pos { return lex.Pos(int(d.EndTok.Pos) + len(d.EndTok.Val)) }
+
+func (d *GenDecl) declNode()  {}
+func (d *FuncDecl) declNode() {}
 
 // ----------------------------------------------------------------------------
 // Files and packages
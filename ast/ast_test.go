@@ -3,6 +3,7 @@ package ast
 import (
 	// "fmt"
 	"github.com/jonfk/calc/lex"
+	"strconv"
 	"testing"
 )
 
@@ -178,28 +179,210 @@ func TestInsertUnary(t *testing.T) {
 	testTree = insert(testTree, &BasicLit{Tok: lex.Token{Typ: lex.INT, Val: "8"}})
 	//fmt.Println(Sprint(testTree))
 
-	expected := &UnaryExpr{
-		Op: lex.Token{Typ: lex.SUB, Val: "-"},
-		X: &UnaryExpr{
-			Op: lex.Token{Typ: lex.ADD, Val: "+"},
-			X: &BinaryExpr{
-				X: &BinaryExpr{
+	// The unary operators bind tighter than * and /.
+	expected := &BinaryExpr{
+		X: &BinaryExpr{
+			X: &UnaryExpr{
+				Op: lex.Token{Typ: lex.SUB, Val: "-"},
+				X: &UnaryExpr{
+					Op: lex.Token{Typ: lex.ADD, Val: "+"},
 					X:  &BasicLit{Tok: lex.Token{Typ: lex.INT, Val: "2"}},
-					Op: lex.Token{Typ: lex.MUL, Val: "*"},
-					Y: &UnaryExpr{Op: lex.Token{Typ: lex.SUB, Val: "-"},
-						X: &ParenExpr{
-							Lparen: lex.Token{Typ: lex.LEFTPAREN, Val: "("},
-							X:      &BasicLit{Tok: lex.Token{Typ: lex.INT, Val: "3"}},
-							Rparen: lex.Token{Typ: lex.RIGHTPAREN, Val: ")"},
-						},
-					},
 				},
-				Op: lex.Token{Typ: lex.QUO, Val: "/"},
-				Y:  &BasicLit{Tok: lex.Token{Typ: lex.INT, Val: "8"}},
+			},
+			Op: lex.Token{Typ: lex.MUL, Val: "*"},
+			Y: &UnaryExpr{Op: lex.Token{Typ: lex.SUB, Val: "-"},
+				X: &ParenExpr{
+					Lparen: lex.Token{Typ: lex.LEFTPAREN, Val: "("},
+					X:      &BasicLit{Tok: lex.Token{Typ: lex.INT, Val: "3"}},
+					Rparen: lex.Token{Typ: lex.RIGHTPAREN, Val: ")"},
+				},
 			},
 		},
+		Op: lex.Token{Typ: lex.QUO, Val: "/"},
+		Y:  &BasicLit{Tok: lex.Token{Typ: lex.INT, Val: "8"}},
 	}
 	if !Equals(testTree, expected) || err != nil {
 		t.Errorf("\nExpected:\n%s\n\nGot:\n%s\n\nWith error: %s\n", Sprint(expected), Sprint(testTree), err)
 	}
 }
+
+func TestBasicLitStringValue(t *testing.T) {
+	tests := []struct {
+		lit      string
+		expected string
+	}{
+		{`"abc"`, "abc"},
+		{`""`, ""},
+		{`"a\"b\\c"`, `a"b\c`},
+		{`"\t\n"`, "\t\n"},
+		{`"\x41\101\u00e9\U0001F600"`, "AAé\U0001F600"},
+	}
+	for _, test := range tests {
+		x := &BasicLit{Tok: lex.Token{Typ: lex.STRING, Val: test.lit}}
+		s, err := x.StringValue()
+		if err != nil || s != test.expected {
+			t.Errorf("%s: expected %q, got %q (%v)", test.lit, test.expected, s, err)
+		}
+	}
+
+	x := &BasicLit{Tok: lex.Token{Typ: lex.INT, Val: "1"}}
+	if _, err := x.StringValue(); err == nil {
+		t.Errorf("Expected an error for an int literal")
+	}
+}
+
+func TestBasicLitIntValue(t *testing.T) {
+	tests := []struct {
+		lit      string
+		expected int64
+	}{
+		{"42", 42},
+		{"017", 17},
+		{"0x1F", 31},
+		{"0c17", 15},
+		{"0B101", 5},
+		{"1_000_000", 1000000},
+		{"0x_ff", 255},
+		{"9223372036854775807", 9223372036854775807},
+	}
+	for _, test := range tests {
+		x := &BasicLit{Tok: lex.Token{Typ: lex.INT, Val: test.lit}}
+		i, err := x.IntValue()
+		if err != nil || i != test.expected {
+			t.Errorf("%s: expected %d, got %d (%v)", test.lit, test.expected, i, err)
+		}
+	}
+
+	errors := []struct {
+		tok lex.Token
+		err error
+	}{
+		{lex.Token{Typ: lex.INT, Val: "9223372036854775808"}, strconv.ErrRange},
+		{lex.Token{Typ: lex.INT, Val: "0x1_0000_0000_0000_0000"}, strconv.ErrRange},
+		{lex.Token{Typ: lex.INT, Val: "0c8"}, strconv.ErrSyntax},
+	}
+	for _, test := range errors {
+		x := &BasicLit{Tok: test.tok}
+		if _, err := x.IntValue(); err != test.err {
+			t.Errorf("%s: expected %v, got %v", test.tok.Val, test.err, err)
+		}
+	}
+	x := &BasicLit{Tok: lex.Token{Typ: lex.FLOAT, Val: "1.5"}}
+	if _, err := x.IntValue(); err == nil {
+		t.Errorf("1.5: expected an error")
+	}
+
+	x = &BasicLit{Tok: lex.Token{Typ: lex.INT, Val: "0x1_0000_0000_0000_0000"}}
+	if b, err := x.BigIntValue(); err != nil || b.String() != "18446744073709551616" {
+		t.Errorf("%s: expected 18446744073709551616, got %s (%v)", x.Tok.Val, b, err)
+	}
+}
+
+func TestBasicLitImagValue(t *testing.T) {
+	tests := []struct {
+		lit       string
+		expected  float64
+		canonical string
+	}{
+		{"3i", 3, "3i"},
+		{"2.5i", 2.5, "2.5i"},
+		{"3.i", 3, "3.0i"},
+		{"1.5E+3i", 1500, "1.5e3i"},
+		{"0X1Fi", 31, "0x1fi"},
+		{"1_000i", 1000, "1_000i"},
+	}
+	for _, test := range tests {
+		x := &BasicLit{Tok: lex.Token{Typ: lex.IMAG, Val: test.lit}}
+		f, err := x.ImagValue()
+		if err != nil || f != test.expected {
+			t.Errorf("%s: expected %g, got %g (%v)", test.lit, test.expected, f, err)
+		}
+		if s := x.Canonical(); s != test.canonical {
+			t.Errorf("%s: expected canonical %s, got %s", test.lit, test.canonical, s)
+		}
+	}
+	x := &BasicLit{Tok: lex.Token{Typ: lex.IMAG, Val: "1e999i"}}
+	if _, err := x.ImagValue(); err != strconv.ErrRange {
+		t.Errorf("%s: expected %v, got %v", x.Tok.Val, strconv.ErrRange, err)
+	}
+}
+
+func TestBasicLitCharValue(t *testing.T) {
+	tests := []struct {
+		lit      string
+		expected rune
+	}{
+		{`'a'`, 'a'},
+		{`'é'`, 'é'},
+		{`'\n'`, '\n'},
+		{`'\''`, '\''},
+		{`'\x41'`, 'A'},
+		{`'\U0001F600'`, '\U0001F600'},
+	}
+	for _, test := range tests {
+		x := &BasicLit{Tok: lex.Token{Typ: lex.CHAR, Val: test.lit}}
+		r, err := x.CharValue()
+		if err != nil || r != test.expected {
+			t.Errorf("%s: expected %q, got %q (%v)", test.lit, test.expected, r, err)
+		}
+	}
+
+	for _, lit := range []lex.Token{{Typ: lex.CHAR, Val: `'ab'`}, {Typ: lex.STRING, Val: `"a"`}} {
+		x := &BasicLit{Tok: lit}
+		if _, err := x.CharValue(); err == nil {
+			t.Errorf("%s: expected an error", lit.Val)
+		}
+	}
+}
+
+func TestWalkNilChildren(t *testing.T) {
+	// an if expression without else, as left by a syntax error
+	x := &IfExpr{
+		Cond: &Ident{Tok: lex.Token{Typ: lex.IDENTIFIER, Val: "a"}},
+		Body: &BlockExpr{List: []Expr{&BasicLit{Tok: lex.Token{Typ: lex.INT, Val: "1"}}}},
+	}
+	nodes := []Node{
+		x,
+		&ExprStmt{X: x},
+		&FuncDecl{Name: NewIdent("f")},
+		&CallExpr{Fun: NewIdent("f"), Args: []Expr{nil}},
+		&ValueSpec{Name: NewIdent("v")},
+		&GenDecl{},
+		&ParenExpr{},
+		&BadStmt{},
+	}
+	for _, n := range nodes {
+		count := 0
+		Inspect(n, func(Node) bool {
+			count++
+			return true
+		})
+		if count == 0 {
+			t.Errorf("%T was not inspected", n)
+		}
+	}
+}
+
+func TestBasicLitCanonical(t *testing.T) {
+	tests := []struct {
+		tok      lex.Token
+		expected string
+	}{
+		{lex.Token{Typ: lex.INT, Val: "42"}, "42"},
+		{lex.Token{Typ: lex.INT, Val: "0X1F"}, "0x1f"},
+		{lex.Token{Typ: lex.INT, Val: "0B101"}, "0b101"},
+		{lex.Token{Typ: lex.FLOAT, Val: "3."}, "3.0"},
+		{lex.Token{Typ: lex.FLOAT, Val: "3.E+2"}, "3.0e2"},
+		{lex.Token{Typ: lex.FLOAT, Val: "1.5e-3"}, "1.5e-3"},
+		{lex.Token{Typ: lex.STRING, Val: `"A\x41"`}, `"A\x41"`},
+	}
+	for _, test := range tests {
+		x := &BasicLit{Tok: test.tok}
+		if s := x.Canonical(); s != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.tok.Val, test.expected, s)
+		}
+		if !Equals(x, &BasicLit{Tok: lex.Token{Typ: test.tok.Typ, Val: test.expected}}) {
+			t.Errorf("%s: expected to equal %s", test.tok.Val, test.expected)
+		}
+	}
+}
@@ -71,7 +71,7 @@ type Object struct {
 	Name string      // declared name
 	Decl interface{} // corresponding Field, XxxSpec, FuncDecl, LabeledStmt, AssignStmt, Scope; or nil
 	Data interface{} // object-specific data; or nil
-	Type interface{} // place holder for type information; may be nil
+	Type interface{} // types.Type of the object once checked; may be nil
 }
 
 // NewObj creates a new object of a given kind and name.
@@ -83,9 +83,24 @@ func NewObj(kind ObjKind, name string) *Object {
 // The result may be an invalid position if it cannot be computed
 // (obj.Decl may be nil or not correct).
 func (obj *Object) Pos() lex.Pos {
+	name := obj.Name
 	switch d := obj.Decl.(type) {
+	case *Field:
+		if d.Name != nil && d.Name.Tok.Val == name {
+			return d.Name.Pos()
+		}
 	case *GenDecl:
-		return d.Pos()
+		if s, ok := d.Spec.(*ValueSpec); ok {
+			for _, n := range s.Names() {
+				if n != nil && n.Tok.Val == name {
+					return n.Pos()
+				}
+			}
+		}
+	case *FuncDecl:
+		if d.Name != nil && d.Name.Tok.Val == name {
+			return d.Name.Pos()
+		}
 	}
 	return lex.NoPos
 }
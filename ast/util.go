@@ -3,6 +3,8 @@ package ast
 import (
 	"bytes"
 	"fmt"
+	"github.com/jonfk/calc/lex"
+	"strings"
 )
 
 // --------------------------------------------------------------------------------
@@ -30,6 +32,13 @@ func InsertExpr(tree, expr Expr) (Expr, error) {
 		default:
 			return nil, fmt.Errorf("InsertExpr: cannot insert expr with type: %T into a BasicLit", t)
 		}
+	case *IfExpr, *LetExpr, *FuncLit, *CallExpr, *TupleExpr:
+		switch t := expr.(type) {
+		case *BinaryExpr:
+			return insertBinaryExpr(tree, expr.(*BinaryExpr))
+		default:
+			return nil, fmt.Errorf("InsertExpr: cannot insert expr with type: %T into a %T", t, tree)
+		}
 	case *ParenExpr:
 		treeP := tree.(*ParenExpr)
 		if treeP.X == nil && treeP.Rparen.Val == "" {
@@ -59,8 +68,10 @@ func InsertExpr(tree, expr Expr) (Expr, error) {
 		} else {
 			switch expr.(type) {
 			case *BinaryExpr:
+				// a unary operator binds tighter than the binary
+				// operators except **
 				exprB := expr.(*BinaryExpr)
-				if exprB.Op.Precedence() >= treeU.Op.Precedence() {
+				if exprB.Op.Precedence() > lex.UnaryPrec || unclosedParen(treeU.X) {
 					var err error
 					treeU.X, err = InsertExpr(treeU.X, expr)
 					return treeU, err
@@ -90,8 +101,6 @@ func insertBinaryExpr(tree Expr, expr *BinaryExpr) (Expr, error) {
 		expr.X = tree
 		return expr, nil
 	}
-	return nil, nil
-
 }
 
 func insertIntoBinaryExpr(tree *BinaryExpr, expr Expr) (Expr, error) {
@@ -104,7 +113,7 @@ func insertIntoBinaryExpr(tree *BinaryExpr, expr Expr) (Expr, error) {
 		switch expr.(type) {
 		case *BinaryExpr:
 			exprB := expr.(*BinaryExpr)
-			if tree.Op.Precedence() >= exprB.Op.Precedence() && !unclosedParen(tree.Y) {
+			if bindsLeft(tree.Op, exprB.Op) && !unclosedParen(tree.Y) {
 				exprB.X = tree
 				return exprB, nil
 			} else {
@@ -122,6 +131,13 @@ func insertIntoBinaryExpr(tree *BinaryExpr, expr Expr) (Expr, error) {
 	}
 }
 
+// bindsLeft reports whether, in x left y right, y is the right operand
+// of the operator left rather than the left operand of right.
+func bindsLeft(left, right lex.Token) bool {
+	lp, rp := left.Precedence(), right.Precedence()
+	return lp > rp || lp == rp && !right.RightAssoc()
+}
+
 func unclosedParen(tree Expr) bool {
 	switch tree.(type) {
 	case *ParenExpr:
@@ -155,17 +171,29 @@ func Equals(a, b Node) bool {
 	case *BasicLit:
 		switch bv := b.(type) {
 		case *BasicLit:
-			if bv.Tok.Equals(av.Tok) {
-				return true
-			}
-			return false
+			// literals spelled differently, as 0X1F and 0x1f, are equal
+			return av.Tok.Typ == bv.Tok.Typ && av.Canonical() == bv.Canonical()
 		}
 	case *ParenExpr:
 		switch bv := b.(type) {
 		case *ParenExpr:
+			// the empty parenthesized expression () has no X
 			return av.Lparen.Equals(bv.Lparen) &&
 				av.Rparen.Equals(bv.Rparen) &&
-				Equals(av.X, bv.X)
+				(av.X == nil && bv.X == nil || Equals(av.X, bv.X))
+		}
+	case *TupleExpr:
+		switch bv := b.(type) {
+		case *TupleExpr:
+			if len(av.Elts) != len(bv.Elts) {
+				return false
+			}
+			for i := range av.Elts {
+				if !Equals(av.Elts[i], bv.Elts[i]) {
+					return false
+				}
+			}
+			return true
 		}
 	case *UnaryExpr:
 		switch bv := b.(type) {
@@ -180,6 +208,88 @@ func Equals(a, b Node) bool {
 				Equals(av.Y, bv.Y) &&
 				Equals(av.X, bv.X)
 		}
+	case *BlockExpr:
+		switch bv := b.(type) {
+		case *BlockExpr:
+			if av == nil || bv == nil {
+				return av == bv
+			}
+			if len(av.List) != len(bv.List) {
+				return false
+			}
+			for i := range av.List {
+				if !Equals(av.List[i], bv.List[i]) {
+					return false
+				}
+			}
+			return true
+		}
+	case *IfExpr:
+		switch bv := b.(type) {
+		case *IfExpr:
+			return Equals(av.Cond, bv.Cond) &&
+				Equals(av.Body, bv.Body) &&
+				Equals(av.Else, bv.Else)
+		}
+	case *LetExpr:
+		switch bv := b.(type) {
+		case *LetExpr:
+			if len(av.Decls) != len(bv.Decls) {
+				return false
+			}
+			for i := range av.Decls {
+				if !Equals(av.Decls[i], bv.Decls[i]) {
+					return false
+				}
+			}
+			return Equals(av.Body, bv.Body)
+		}
+	case *FuncLit:
+		switch bv := b.(type) {
+		case *FuncLit:
+			return Equals(av.Params, bv.Params) &&
+				(av.Result == nil && bv.Result == nil || Equals(av.Result, bv.Result)) &&
+				Equals(av.Body, bv.Body)
+		}
+	case *CallExpr:
+		switch bv := b.(type) {
+		case *CallExpr:
+			if len(av.Args) != len(bv.Args) {
+				return false
+			}
+			for i := range av.Args {
+				if !Equals(av.Args[i], bv.Args[i]) {
+					return false
+				}
+			}
+			return Equals(av.Fun, bv.Fun)
+		}
+	case *Field:
+		switch bv := b.(type) {
+		case *Field:
+			return Equals(av.Name, bv.Name) &&
+				(av.Type == nil && bv.Type == nil || Equals(av.Type, bv.Type))
+		}
+	case *FieldList:
+		switch bv := b.(type) {
+		case *FieldList:
+			if av.NumFields() != bv.NumFields() {
+				return false
+			}
+			for i := 0; i < av.NumFields(); i++ {
+				if !Equals(av.List[i], bv.List[i]) {
+					return false
+				}
+			}
+			return true
+		}
+	case *BadExpr:
+		// bad expressions are equal regardless of their position
+		_, ok := b.(*BadExpr)
+		return ok
+	case *BadStmt:
+		_, ok := b.(*BadStmt)
+		return ok
 	case *ExprStmt:
 		switch bv := b.(type) {
 		case *ExprStmt:
@@ -200,6 +310,14 @@ func Equals(a, b Node) bool {
 	case *ValueSpec:
 		switch bv := b.(type) {
 		case *ValueSpec:
+			if !(av.Type == nil && bv.Type == nil || Equals(av.Type, bv.Type)) {
+				return false
+			}
+			if av.Pattern != nil || bv.Pattern != nil {
+				return av.Pattern != nil && bv.Pattern != nil &&
+					Equals(av.Pattern, bv.Pattern) &&
+					Equals(av.Value, bv.Value)
+			}
 			return Equals(av.Name, bv.Name) &&
 				Equals(av.Value, bv.Value)
 		}
@@ -209,6 +327,14 @@ func Equals(a, b Node) bool {
 			return av.Tok.Equals(bv.Tok) &&
 				Equals(av.Spec, bv.Spec)
 		}
+	case *FuncDecl:
+		switch bv := b.(type) {
+		case *FuncDecl:
+			return Equals(av.Name, bv.Name) &&
+				Equals(av.Params, bv.Params) &&
+				(av.Result == nil && bv.Result == nil || Equals(av.Result, bv.Result)) &&
+				Equals(av.Body, bv.Body)
+		}
 	case *File:
 		switch bv := b.(type) {
 		case *File:
@@ -246,6 +372,24 @@ func sprintd(n Node, d int) string {
 		return nt.StringDepth(d)
 	case *BinaryExpr:
 		return nt.StringDepth(d)
+	case *BlockExpr:
+		return nt.StringDepth(d)
+	case *IfExpr:
+		return nt.StringDepth(d)
+	case *LetExpr:
+		return nt.StringDepth(d)
+	case *TupleExpr:
+		return nt.StringDepth(d)
+	case *FuncLit:
+		return nt.StringDepth(d)
+	case *CallExpr:
+		return nt.StringDepth(d)
+	case *FieldList:
+		return nt.String()
+	case *BadExpr:
+		return nt.String()
+	case *BadStmt:
+		return nt.String()
 	case *ExprStmt:
 		return nt.String()
 	case *AssignStmt:
@@ -256,6 +400,8 @@ func sprintd(n Node, d int) string {
 		return nt.StringDepth(d)
 	case *GenDecl:
 		return nt.StringDepth(d)
+	case *FuncDecl:
+		return nt.StringDepth(d)
 	case *File:
 		return nt.String()
 	case nil:
@@ -263,7 +409,14 @@ func sprintd(n Node, d int) string {
 	default:
 		return "<<UNKNOWN>>"
 	}
-	return ""
+}
+
+func (n *BadExpr) String() string {
+	return fmt.Sprintf("(BadExpr %d-%d)", n.From, n.To)
+}
+
+func (n *BadStmt) String() string {
+	return fmt.Sprintf("(BadStmt %d-%d)", n.From.Pos, n.To.Pos)
 }
 
 func (id *Ident) String() string {
@@ -281,6 +434,10 @@ func (n *ParenExpr) String() string {
 	return n.StringDepth(0)
 }
 
+func (n *TupleExpr) String() string {
+	return n.StringDepth(0)
+}
+
 func (n *UnaryExpr) String() string {
 	return n.StringDepth(0)
 	// return fmt.Sprintf("(UnaryExpr \n\tOp:%s \n\tX:%s)", n.Op, sprintd(n.X, 0))
@@ -291,6 +448,42 @@ func (n *BinaryExpr) String() string {
 	// return fmt.Sprintf("(BinaryExpr \n\tOp:%s \n\tX:%s \n\tY:%s)", n.Op, sprintd(n.X, 0), sprintd(n.Y, 0))
 }
 
+func (n *BlockExpr) String() string {
+	return n.StringDepth(0)
+}
+
+func (n *IfExpr) String() string {
+	return n.StringDepth(0)
+}
+
+func (n *LetExpr) String() string {
+	return n.StringDepth(0)
+}
+
+func (n *FuncLit) String() string {
+	return n.StringDepth(0)
+}
+
+func (n *CallExpr) String() string {
+	return n.StringDepth(0)
+}
+
+func (n *FieldList) String() string {
+	var names []string
+	for _, f := range n.List {
+		if f.Type != nil {
+			names = append(names, f.Name.String()+": "+Sprint(f.Type))
+			continue
+		}
+		names = append(names, f.Name.String())
+	}
+	return "(" + strings.Join(names, ", ") + ")"
+}
+
+func (n *FuncDecl) String() string {
+	return n.StringDepth(0)
+}
+
 func (n *ExprStmt) String() string {
 	return Sprint(n.X)
 }
@@ -328,6 +521,14 @@ func (n *ParenExpr) StringDepth(d int) string {
 	return fmt.Sprintf("(ParenExpr '%s' %s '%s')", n.Lparen.Val, sprintd(n.X, d+1), n.Rparen.Val)
 }
 
+func (n *TupleExpr) StringDepth(d int) string {
+	var elts []string
+	for _, x := range n.Elts {
+		elts = append(elts, sprintd(x, d+1))
+	}
+	return fmt.Sprintf("(TupleExpr %s)", strings.Join(elts, ", "))
+}
+
 func (n *UnaryExpr) StringDepth(d int) string {
 	var buffer bytes.Buffer
 	buffer.WriteString("(UnaryExpr ")
@@ -376,6 +577,159 @@ func (n *BinaryExpr) StringDepth(d int) string {
 	return buffer.String()
 }
 
+func (n *BlockExpr) StringDepth(d int) string {
+	var buffer bytes.Buffer
+	buffer.WriteString("(BlockExpr")
+	for _, x := range n.List {
+		buffer.WriteString("\n")
+		for i := 0; i < d; i++ {
+			buffer.WriteString("\t")
+		}
+		buffer.WriteString(sprintd(x, d+1))
+	}
+	buffer.WriteString(")")
+
+	return buffer.String()
+}
+
+func (n *IfExpr) StringDepth(d int) string {
+	var buffer bytes.Buffer
+	buffer.WriteString("(IfExpr ")
+	buffer.WriteString("\n")
+	for i := 0; i < d; i++ {
+		buffer.WriteString("\t")
+	}
+	buffer.WriteString("Cond: ")
+	buffer.WriteString(sprintd(n.Cond, d+1))
+
+	buffer.WriteString("\n")
+	for i := 0; i < d; i++ {
+		buffer.WriteString("\t")
+	}
+	buffer.WriteString("Body: ")
+	buffer.WriteString(sprintd(n.Body, d+1))
+
+	buffer.WriteString("\n")
+	for i := 0; i < d; i++ {
+		buffer.WriteString("\t")
+	}
+	buffer.WriteString("Else: ")
+	buffer.WriteString(sprintd(n.Else, d+1))
+	buffer.WriteString(")")
+
+	return buffer.String()
+}
+
+func (n *LetExpr) StringDepth(d int) string {
+	var buffer bytes.Buffer
+	buffer.WriteString("(LetExpr ")
+	for _, decl := range n.Decls {
+		buffer.WriteString("\n")
+		for i := 0; i < d; i++ {
+			buffer.WriteString("\t")
+		}
+		buffer.WriteString("Decl: ")
+		buffer.WriteString(sprintd(decl, d+1))
+	}
+
+	buffer.WriteString("\n")
+	for i := 0; i < d; i++ {
+		buffer.WriteString("\t")
+	}
+	buffer.WriteString("Body: ")
+	buffer.WriteString(sprintd(n.Body, d+1))
+	buffer.WriteString(")")
+
+	return buffer.String()
+}
+
+func (n *FuncLit) StringDepth(d int) string {
+	var buffer bytes.Buffer
+	buffer.WriteString("(FuncLit ")
+	buffer.WriteString("\n")
+	for i := 0; i < d; i++ {
+		buffer.WriteString("\t")
+	}
+	buffer.WriteString("Params: ")
+	buffer.WriteString(sprintd(n.Params, d+1))
+	if n.Result != nil {
+		buffer.WriteString("\n")
+		for i := 0; i < d; i++ {
+			buffer.WriteString("\t")
+		}
+		buffer.WriteString("Result: ")
+		buffer.WriteString(sprintd(n.Result, d+1))
+	}
+
+	buffer.WriteString("\n")
+	for i := 0; i < d; i++ {
+		buffer.WriteString("\t")
+	}
+	buffer.WriteString("Body: ")
+	buffer.WriteString(sprintd(n.Body, d+1))
+	buffer.WriteString(")")
+
+	return buffer.String()
+}
+
+func (n *CallExpr) StringDepth(d int) string {
+	var buffer bytes.Buffer
+	buffer.WriteString("(CallExpr ")
+	buffer.WriteString("\n")
+	for i := 0; i < d; i++ {
+		buffer.WriteString("\t")
+	}
+	buffer.WriteString("Fun: ")
+	buffer.WriteString(sprintd(n.Fun, d+1))
+	for _, arg := range n.Args {
+		buffer.WriteString("\n")
+		for i := 0; i < d; i++ {
+			buffer.WriteString("\t")
+		}
+		buffer.WriteString("Arg: ")
+		buffer.WriteString(sprintd(arg, d+1))
+	}
+	buffer.WriteString(")")
+
+	return buffer.String()
+}
+
+func (n *FuncDecl) StringDepth(d int) string {
+	var buffer bytes.Buffer
+	buffer.WriteString("(FuncDecl ")
+	buffer.WriteString("\n")
+	for i := 0; i < d; i++ {
+		buffer.WriteString("\t")
+	}
+	buffer.WriteString("Name: ")
+	buffer.WriteString(sprintd(n.Name, d+1))
+
+	buffer.WriteString("\n")
+	for i := 0; i < d; i++ {
+		buffer.WriteString("\t")
+	}
+	buffer.WriteString("Params: ")
+	buffer.WriteString(sprintd(n.Params, d+1))
+	if n.Result != nil {
+		buffer.WriteString("\n")
+		for i := 0; i < d; i++ {
+			buffer.WriteString("\t")
+		}
+		buffer.WriteString("Result: ")
+		buffer.WriteString(sprintd(n.Result, d+1))
+	}
+
+	buffer.WriteString("\n")
+	for i := 0; i < d; i++ {
+		buffer.WriteString("\t")
+	}
+	buffer.WriteString("Body: ")
+	buffer.WriteString(sprintd(n.Body, d+1))
+	buffer.WriteString(")")
+
+	return buffer.String()
+}
+
 func (n *AssignStmt) StringDepth(d int) string {
 	var buffer bytes.Buffer
 	buffer.WriteString("(AssignStmt ")
@@ -416,8 +770,21 @@ func (n *ValueSpec) StringDepth(d int) string {
 	for i := 0; i < d; i++ {
 		buffer.WriteString("\t")
 	}
-	buffer.WriteString("Name: ")
-	buffer.WriteString(sprintd(n.Name, d+1))
+	if n.Pattern != nil {
+		buffer.WriteString("Pattern: ")
+		buffer.WriteString(sprintd(n.Pattern, d+1))
+	} else {
+		buffer.WriteString("Name: ")
+		buffer.WriteString(sprintd(n.Name, d+1))
+	}
+	if n.Type != nil {
+		buffer.WriteString("\n")
+		for i := 0; i < d; i++ {
+			buffer.WriteString("\t")
+		}
+		buffer.WriteString("Type: ")
+		buffer.WriteString(sprintd(n.Type, d+1))
+	}
 
 	buffer.WriteString("\n")
 	for i := 0; i < d; i++ {
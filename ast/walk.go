@@ -13,13 +13,33 @@ type Visitor interface {
 
 func walkIdentList(v Visitor, list []*Ident) {
 	for _, x := range list {
-		Walk(v, x)
+		if x != nil {
+			Walk(v, x)
+		}
 	}
 }
 
 func walkExprList(v Visitor, list []Expr) {
 	for _, x := range list {
-		Walk(v, x)
+		if x != nil {
+			Walk(v, x)
+		}
+	}
+}
+
+func walkStmtList(v Visitor, list []Stmt) {
+	for _, x := range list {
+		if x != nil {
+			Walk(v, x)
+		}
+	}
+}
+
+func walkDeclList(v Visitor, list []Decl) {
+	for _, x := range list {
+		if x != nil {
+			Walk(v, x)
+		}
 	}
 }
 
@@ -50,45 +70,161 @@ func Walk(v Visitor, node Node) {
 			Walk(v, c)
 		}
 
+	case *Field:
+		if n.Name != nil {
+			Walk(v, n.Name)
+		}
+		if n.Type != nil {
+			Walk(v, n.Type)
+		}
+
+	case *FieldList:
+		for _, f := range n.List {
+			Walk(v, f)
+		}
+
 	// Expressions
 	case *BadExpr, *Ident, *BasicLit:
 		// nothing to do
 
 	case *ParenExpr:
-		Walk(v, n.X)
+		if n.X != nil {
+			Walk(v, n.X)
+		}
+
+	case *TupleExpr:
+		walkExprList(v, n.Elts)
 
 	case *UnaryExpr:
-		Walk(v, n.X)
+		if n.X != nil {
+			Walk(v, n.X)
+		}
 
 	case *BinaryExpr:
-		Walk(v, n.X)
-		Walk(v, n.Y)
+		if n.X != nil {
+			Walk(v, n.X)
+		}
+		if n.Y != nil {
+			Walk(v, n.Y)
+		}
 
 	case *BlockExpr:
 		walkExprList(v, n.List)
 
 	case *IfExpr:
-		Walk(v, n.Cond)
-		Walk(v, n.Body)
-		Walk(v, n.Else)
+		if n.Cond != nil {
+			Walk(v, n.Cond)
+		}
+		if n.Body != nil {
+			Walk(v, n.Body)
+		}
+		if n.Else != nil {
+			Walk(v, n.Else)
+		}
+
+	case *LetExpr:
+		walkDeclList(v, n.Decls)
+		if n.Body != nil {
+			Walk(v, n.Body)
+		}
+
+	case *FuncLit:
+		if n.Params != nil {
+			Walk(v, n.Params)
+		}
+		if n.Result != nil {
+			Walk(v, n.Result)
+		}
+		if n.Body != nil {
+			Walk(v, n.Body)
+		}
+
+	case *CallExpr:
+		if n.Fun != nil {
+			Walk(v, n.Fun)
+		}
+		walkExprList(v, n.Args)
+
+	// Statements
+	case *BadStmt:
+		// nothing to do
+
+	case *DeclStmt:
+		if n.Decl != nil {
+			Walk(v, n.Decl)
+		}
+
+	case *ExprStmt:
+		if n.X != nil {
+			Walk(v, n.X)
+		}
+
+	case *AssignStmt:
+		if n.Lhs != nil {
+			Walk(v, n.Lhs)
+		}
+		if n.Rhs != nil {
+			Walk(v, n.Rhs)
+		}
+
+	// Declarations
+	case *ValueSpec:
+		if n.Doc != nil {
+			Walk(v, n.Doc)
+		}
+		if n.Pattern != nil {
+			Walk(v, n.Pattern)
+		}
+		if n.Name != nil {
+			Walk(v, n.Name)
+		}
+		if n.Type != nil {
+			Walk(v, n.Type)
+		}
+		if n.Value != nil {
+			Walk(v, n.Value)
+		}
+		if n.Comment != nil {
+			Walk(v, n.Comment)
+		}
+
+	case *GenDecl:
+		if n.Doc != nil {
+			Walk(v, n.Doc)
+		}
+		if n.Spec != nil {
+			Walk(v, n.Spec)
+		}
+
+	case *FuncDecl:
+		if n.Doc != nil {
+			Walk(v, n.Doc)
+		}
+		if n.Name != nil {
+			Walk(v, n.Name)
+		}
+		if n.Params != nil {
+			Walk(v, n.Params)
+		}
+		if n.Result != nil {
+			Walk(v, n.Result)
+		}
+		if n.Body != nil {
+			Walk(v, n.Body)
+		}
 
 	// Files and packages
 	case *File:
 		if n.Doc != nil {
 			Walk(v, n.Doc)
 		}
-		//Walk(v, n.Name)
-		//Walk(v, n.List)
-		for _, node := range n.List {
-			Walk(v, node)
-		}
+		walkStmtList(v, n.List)
 		// don't walk n.Comments - they have been
 		// visited already through the individual
 		// nodes
 
 	default:
-		fmt.Printf("ast.Walk: unexpected node type %T", n)
-		panic("ast.Walk")
+		panic(fmt.Sprintf("ast.Walk: unexpected node type %T", n))
 	}
 
 	v.Visit(nil)
@@ -0,0 +1,96 @@
+// Package doc extracts the documentation of the top-level declarations
+// of calc files and renders it as plain text, Markdown or HTML.
+//
+// The documentation of a declaration is the comment group ending on the
+// line before it, or else for a val or var declaration its line
+// comment. The documentation of a file is its first comment group if it
+// is separated from the first declaration by a blank line.
+package doc
+
+import (
+	"bytes"
+	"github.com/jonfk/calc/ast"
+	"github.com/jonfk/calc/lex"
+	"github.com/jonfk/calc/printer"
+	"strings"
+)
+
+// File is the documentation of a calc file.
+type File struct {
+	Name  string  // file name
+	Doc   string  // file documentation; or ""
+	Decls []*Decl // top-level declarations in source order
+}
+
+// Decl is the documentation of a top-level val, var or def declaration.
+type Decl struct {
+	Names []string     // declared names; several for a tuple pattern
+	Kind  ast.ObjKind  // ast.Val, ast.Var or ast.Fun
+	Decl  string       // source of the declaration, without a function body
+	Doc   string       // documentation; or ""
+	Pos   lex.Position // position of the declaration
+}
+
+// New returns the documentation of file, whose positions are
+// interpreted relative to fset.
+func New(fset *lex.FileSet, name string, file *ast.File) *File {
+	f := &File{Name: name, Doc: file.Doc.Text()}
+	for _, s := range file.List {
+		ds, ok := s.(*ast.DeclStmt)
+		if !ok {
+			continue
+		}
+		switch d := ds.Decl.(type) {
+		case *ast.GenDecl:
+			spec := d.Spec.(*ast.ValueSpec)
+			decl := &Decl{
+				Kind: objKind(d.Tok),
+				Decl: source(d),
+				Doc:  d.Doc.Text(),
+				Pos:  fset.Position(d.Pos()),
+			}
+			if decl.Doc == "" {
+				decl.Doc = spec.Doc.Text()
+			}
+			if decl.Doc == "" {
+				decl.Doc = spec.Comment.Text()
+			}
+			for _, name := range spec.Names() {
+				decl.Names = append(decl.Names, name.Tok.Val)
+			}
+			f.Decls = append(f.Decls, decl)
+		case *ast.FuncDecl:
+			// The signature is the source up to the = before the body.
+			sig := source(d)
+			sig = sig[:strings.Index(sig, " =")]
+			f.Decls = append(f.Decls, &Decl{
+				Names: []string{d.Name.Tok.Val},
+				Kind:  ast.Fun,
+				Decl:  sig,
+				Doc:   d.Doc.Text(),
+				Pos:   fset.Position(d.Pos()),
+			})
+		}
+	}
+	return f
+}
+
+// objKind returns the kind of the objects declared with the keyword tok.
+func objKind(tok lex.Token) ast.ObjKind {
+	if tok.Typ == lex.VAR {
+		return ast.Var
+	}
+	return ast.Val
+}
+
+// source returns the formatted source of a declaration on one line.
+func source(d ast.Decl) string {
+	var buf bytes.Buffer
+	printer.Fprint(&buf, nil, d)
+	return buf.String()
+}
+
+// Name returns the declared names joined by commas.
+func (d *Decl) Name() string {
+	return strings.Join(d.Names, ", ")
+}
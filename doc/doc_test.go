@@ -0,0 +1,140 @@
+package doc
+
+import (
+	"bytes"
+	"github.com/jonfk/calc/ast"
+	"github.com/jonfk/calc/lex"
+	"github.com/jonfk/calc/parse"
+	"strings"
+	"testing"
+)
+
+const testInput = `// Package consts holds constants.
+
+// Pi is the ratio of a circle to its diameter.
+val pi = 3.14159
+
+var count = 0 // number of calls
+
+// swap returns its arguments swapped.
+//
+// It works on any values.
+def swap(a, b) = (b, a) end
+
+// scale multiplies x by k.
+def scale(x: float, k): float =
+  x * k
+end
+
+val (x, (y, z)) = (1, (2, 3))
+
+pi * 2
+val f = fn (x) =>
+  x < 1 && 2 > 1
+end
+`
+
+func newFile(t *testing.T, input string) *File {
+	fset := lex.NewFileSet()
+	file, err := parse.ParseFile(fset, "consts.calc", input)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return New(fset, "consts.calc", file)
+}
+
+func TestNew(t *testing.T) {
+	f := newFile(t, testInput)
+	if f.Doc != "Package consts holds constants.\n" {
+		t.Errorf("Expected file doc, got %q", f.Doc)
+	}
+	expected := []struct {
+		names string
+		kind  ast.ObjKind
+		decl  string
+		doc   string
+		pos   string
+	}{
+		{"pi", ast.Val, "val pi = 3.14159", "Pi is the ratio of a circle to its diameter.\n", "consts.calc:4:1"},
+		{"count", ast.Var, "var count = 0", "number of calls\n", "consts.calc:6:1"},
+		{"swap", ast.Fun, "def swap(a, b)", "swap returns its arguments swapped.\n\nIt works on any values.\n", "consts.calc:11:1"},
+		{"scale", ast.Fun, "def scale(x: float, k): float", "scale multiplies x by k.\n", "consts.calc:14:1"},
+		{"x, y, z", ast.Val, "val (x, (y, z)) = (1, (2, 3))", "", "consts.calc:18:1"},
+		{"f", ast.Val, "val f = fn (x) => x < 1 && 2 > 1 end", "", "consts.calc:21:1"},
+	}
+	if len(f.Decls) != len(expected) {
+		t.Fatalf("Expected %d declarations, got %d", len(expected), len(f.Decls))
+	}
+	for i, e := range expected {
+		d := f.Decls[i]
+		if d.Name() != e.names || d.Kind != e.kind || d.Decl != e.decl || d.Doc != e.doc || d.Pos.String() != e.pos {
+			t.Errorf("declaration %d:\nExpected %s %s %q %q %s\nGot      %s %s %q %q %s",
+				i, e.names, e.kind, e.decl, e.doc, e.pos, d.Name(), d.Kind, d.Decl, d.Doc, d.Pos)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	f := newFile(t, "// Area of a circle.\ndef area(r) = 3 * r * r end\nval lt = 1 < 2 // a <b> *c* [d]\n")
+	tests := []struct {
+		format   Format
+		expected string
+	}{
+		{Text, `FILE consts.calc
+
+def area(r)
+    func, consts.calc:2:1
+
+    Area of a circle.
+
+val lt = 1 < 2
+    val, consts.calc:3:1
+
+    a <b> *c* [d]
+`},
+		{Markdown, "# consts.calc\n\n## area\n\n```\ndef area(r)\n```\n\n*func*, defined at `consts.calc:2:1`\n\nArea of a circle.\n" +
+			"\n## lt\n\n```\nval lt = 1 < 2\n```\n\n*val*, defined at `consts.calc:3:1`\n\na \\<b\\> \\*c\\* \\[d\\]\n"},
+		{HTML, `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>consts.calc</title>
+</head>
+<body>
+<section>
+<h1>consts.calc</h1>
+<h2 id="area">area</h2>
+<pre>def area(r)</pre>
+<p><em>func</em>, defined at <code>consts.calc:2:1</code></p>
+<p>Area of a circle.</p>
+<h2 id="lt">lt</h2>
+<pre>val lt = 1 &lt; 2</pre>
+<p><em>val</em>, defined at <code>consts.calc:3:1</code></p>
+<p>a &lt;b&gt; *c* [d]</p>
+</section>
+</body>
+</html>
+`},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := Write(&buf, test.format, f); err != nil {
+			t.Errorf("%s: unexpected error: %s", test.format, err)
+			continue
+		}
+		if buf.String() != test.expected {
+			t.Errorf("%s:\nExpected:\n%s\nGot:\n%s", test.format, test.expected, buf.String())
+		}
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, f := range []Format{Text, Markdown, HTML} {
+		if g, err := ParseFormat(f.String()); err != nil || g != f {
+			t.Errorf("%s: got %s, %v", f, g, err)
+		}
+	}
+	if _, err := ParseFormat("pdf"); err == nil || !strings.Contains(err.Error(), "pdf") {
+		t.Errorf("Expected an error for an unknown format, got %v", err)
+	}
+}
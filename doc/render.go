@@ -0,0 +1,171 @@
+package doc
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strings"
+)
+
+// A Format is an output format for documentation.
+type Format int
+
+// The supported output formats.
+const (
+	Text Format = iota
+	Markdown
+	HTML
+)
+
+var formatNames = [...]string{
+	Text:     "text",
+	Markdown: "markdown",
+	HTML:     "html",
+}
+
+func (f Format) String() string { return formatNames[f] }
+
+// ParseFormat returns the format with the given name.
+func ParseFormat(name string) (Format, error) {
+	for f, n := range formatNames {
+		if n == name {
+			return Format(f), nil
+		}
+	}
+	return Text, fmt.Errorf("unknown documentation format %q", name)
+}
+
+// Write renders the documentation of files in the given format to w.
+// HTML output is a complete page.
+func Write(w io.Writer, format Format, files ...*File) error {
+	ew := &errWriter{w: w}
+	switch format {
+	case Text:
+		for i, f := range files {
+			if i > 0 {
+				ew.printf("\n")
+			}
+			writeText(ew, f)
+		}
+	case Markdown:
+		for i, f := range files {
+			if i > 0 {
+				ew.printf("\n")
+			}
+			writeMarkdown(ew, f)
+		}
+	case HTML:
+		ew.printf("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+		if len(files) == 1 {
+			ew.printf("<title>%s</title>\n", html.EscapeString(files[0].Name))
+		}
+		ew.printf("</head>\n<body>\n")
+		for _, f := range files {
+			writeHTML(ew, f)
+		}
+		ew.printf("</body>\n</html>\n")
+	default:
+		return fmt.Errorf("doc: unknown format %d", format)
+	}
+	return ew.err
+}
+
+// An errWriter writes to w until an error occurs, which it keeps.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) printf(format string, args ...interface{}) {
+	if ew.err == nil {
+		_, ew.err = fmt.Fprintf(ew.w, format, args...)
+	}
+}
+
+// indent returns text with every non-empty line prefixed by prefix.
+func indent(text, prefix string) string {
+	lines := strings.SplitAfter(text, "\n")
+	for i, l := range lines {
+		if l != "" && l != "\n" {
+			lines[i] = prefix + l
+		}
+	}
+	return strings.Join(lines, "")
+}
+
+// paragraphs splits doc text into paragraphs separated by blank lines.
+func paragraphs(text string) []string {
+	var paras []string
+	for _, p := range strings.Split(text, "\n\n") {
+		if p = strings.TrimSpace(p); p != "" {
+			paras = append(paras, p)
+		}
+	}
+	return paras
+}
+
+// writeText renders a file as plain text:
+//
+//	FILE name
+//
+//	    file doc
+//
+//	val x = 1
+//	    val, name:1:1
+//
+//	    doc
+func writeText(ew *errWriter, f *File) {
+	ew.printf("FILE %s\n", f.Name)
+	if f.Doc != "" {
+		ew.printf("\n%s", indent(f.Doc, "    "))
+	}
+	for _, d := range f.Decls {
+		ew.printf("\n%s\n    %s, %s\n", d.Decl, d.Kind, d.Pos)
+		if d.Doc != "" {
+			ew.printf("\n%s", indent(d.Doc, "    "))
+		}
+	}
+}
+
+// markdownEscaper escapes the characters of text that Markdown would
+// take as markup.
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`,
+	"<", `\<`, ">", `\>`, "#", `\#`, "|", `\|`,
+)
+
+// writeMarkdown renders a file as Markdown, with a section for each
+// declaration. Names and documentation are escaped; declarations are
+// in code blocks.
+func writeMarkdown(ew *errWriter, f *File) {
+	ew.printf("# %s\n", markdownEscaper.Replace(f.Name))
+	if f.Doc != "" {
+		ew.printf("\n%s", markdownEscaper.Replace(f.Doc))
+	}
+	for _, d := range f.Decls {
+		ew.printf("\n## %s\n\n", markdownEscaper.Replace(d.Name()))
+		ew.printf("```\n%s\n```\n\n", d.Decl)
+		ew.printf("*%s*, defined at `%s`\n", d.Kind, d.Pos)
+		if d.Doc != "" {
+			ew.printf("\n%s", markdownEscaper.Replace(d.Doc))
+		}
+	}
+}
+
+// writeHTML renders a file as a section of an HTML page, with an
+// anchor for each declaration.
+func writeHTML(ew *errWriter, f *File) {
+	ew.printf("<section>\n<h1>%s</h1>\n", html.EscapeString(f.Name))
+	for _, p := range paragraphs(f.Doc) {
+		ew.printf("<p>%s</p>\n", html.EscapeString(p))
+	}
+	for _, d := range f.Decls {
+		ew.printf("<h2 id=\"%s\">%s</h2>\n", html.EscapeString(d.Names[0]), html.EscapeString(d.Name()))
+		ew.printf("<pre>%s</pre>\n", html.EscapeString(d.Decl))
+		ew.printf("<p><em>%s</em>, defined at <code>%s</code></p>\n", d.Kind, html.EscapeString(d.Pos.String()))
+		for _, p := range paragraphs(d.Doc) {
+			ew.printf("<p>%s</p>\n", html.EscapeString(p))
+		}
+	}
+	ew.printf("</section>\n")
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/jonfk/calc/doc"
+	"os"
+)
+
+const docUsage = `usage: calc doc [-format text|markdown|html] file...
+
+Doc prints the documentation of the top-level val, var and def
+declarations of calc files: the comment before each declaration, or
+else its line comment, together with its kind and position.
+
+Flags:
+  -format   output format: text (default), markdown or html
+`
+
+// docMain runs the doc command with the arguments following its name
+// and returns the exit status of the program.
+func docMain(args []string) int {
+	flags := flag.NewFlagSet("doc", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, docUsage) }
+	formatName := flags.String("format", "text", "output format")
+	if err := flags.Parse(args); err != nil || flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+	format, err := doc.ParseFormat(*formatName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "calc doc: %s\n", err)
+		return 2
+	}
+
+	status := 0
+	var files []*doc.File
+	for _, name := range flags.Args() {
+		input, err := readInput(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+			continue
+		}
+		if name == "-" {
+			name = "<stdin>"
+		}
+		file, ok := parseInput(name, input)
+		if !ok {
+			status = 1
+			continue
+		}
+		files = append(files, doc.New(fset, name, file))
+	}
+	if len(files) == 0 {
+		return status
+	}
+	if err := doc.Write(os.Stdout, format, files...); err != nil {
+		fmt.Fprintf(os.Stderr, "calc doc: %s\n", err)
+		return 1
+	}
+	return status
+}
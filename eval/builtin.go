@@ -0,0 +1,136 @@
+package eval
+
+import (
+	"github.com/jonfk/calc/ast"
+	"math"
+	"math/big"
+	"math/cmplx"
+	"unicode/utf8"
+)
+
+// universe holds the builtin functions. It is the outermost
+// environment of every Interpreter, so declarations may shadow them.
+var universe = NewEnv(nil)
+
+var builtins = []*Builtin{
+	{Name: "len", NumArgs: 1, Fn: builtinLen},
+	{Name: "int", NumArgs: 1, Fn: builtinInt},
+	{Name: "char", NumArgs: 1, Fn: builtinChar},
+	{Name: "real", NumArgs: 1, Fn: builtinReal},
+	{Name: "imag", NumArgs: 1, Fn: builtinImag},
+	{Name: "abs", NumArgs: 1, Fn: builtinAbs},
+	{Name: "conj", NumArgs: 1, Fn: builtinConj},
+	{Name: "phase", NumArgs: 1, Fn: builtinPhase},
+}
+
+func init() {
+	for _, b := range builtins {
+		universe.Define(b.Name, ast.Fun, b)
+	}
+}
+
+// IsBuiltin reports whether name denotes a builtin function.
+func IsBuiltin(name string) bool {
+	_, ok := universe.bindings[name]
+	return ok
+}
+
+// builtinLen returns the number of characters of a string or the
+// number of elements of a tuple.
+func builtinLen(x *ast.CallExpr, args []Value) Value {
+	switch v := args[0].(type) {
+	case String:
+		return Int(utf8.RuneCountInString(string(v)))
+	case Tuple:
+		return Int(len(v))
+	}
+	errorf(x.Args[0].Pos(), "invalid argument %s of kind %s for len", args[0], args[0].Kind())
+	return nil
+}
+
+// builtinInt returns the code point of a character. Ints are
+// returned unchanged and rational numbers are truncated.
+func builtinInt(x *ast.CallExpr, args []Value) Value {
+	switch v := args[0].(type) {
+	case Int, BigInt:
+		return v
+	case Rat:
+		return newInt(new(big.Int).Quo(v.x.Num(), v.x.Denom()))
+	case Char:
+		return Int(v)
+	}
+	errorf(x.Args[0].Pos(), "cannot convert %s of kind %s to int", args[0], args[0].Kind())
+	return nil
+}
+
+// builtinChar returns the character with the code point given by
+// an int. Chars are returned unchanged.
+func builtinChar(x *ast.CallExpr, args []Value) Value {
+	switch v := args[0].(type) {
+	case Char:
+		return v
+	case Int:
+		if v < 0 || v > utf8.MaxRune || !utf8.ValidRune(rune(v)) {
+			errorf(x.Args[0].Pos(), "cannot convert %d to char: invalid code point", v)
+		}
+		return Char(v)
+	case BigInt:
+		errorf(x.Args[0].Pos(), "cannot convert %s to char: invalid code point", v)
+	case Rat:
+		errorf(x.Args[0].Pos(), "cannot convert rational number %s to char: not an integer", v)
+	}
+	errorf(x.Args[0].Pos(), "cannot convert %s of kind %s to char", args[0], args[0].Kind())
+	return nil
+}
+
+// complexArg returns the argument of a call to the builtin name
+// taking a number as a complex number.
+func complexArg(x *ast.CallExpr, name string, args []Value) complex128 {
+	if !isNumeric(args[0]) {
+		errorf(x.Args[0].Pos(), "invalid argument %s of kind %s for %s", args[0], args[0].Kind(), name)
+	}
+	return complex128(toComplex(args[0]))
+}
+
+// builtinReal returns the real part of a number.
+func builtinReal(x *ast.CallExpr, args []Value) Value {
+	return Float(real(complexArg(x, "real", args)))
+}
+
+// builtinImag returns the imaginary part of a number, which is 0 for
+// ints and floats.
+func builtinImag(x *ast.CallExpr, args []Value) Value {
+	return Float(imag(complexArg(x, "imag", args)))
+}
+
+// builtinConj returns the complex conjugate of a number.
+func builtinConj(x *ast.CallExpr, args []Value) Value {
+	return Complex(cmplx.Conj(complexArg(x, "conj", args)))
+}
+
+// builtinPhase returns the phase of a number, in the range [-Pi, Pi].
+func builtinPhase(x *ast.CallExpr, args []Value) Value {
+	return Float(cmplx.Phase(complexArg(x, "phase", args)))
+}
+
+// builtinAbs returns the absolute value of a number. The absolute
+// value of an int or a rational number is exact, and that of a complex
+// number is its modulus, a float.
+func builtinAbs(x *ast.CallExpr, args []Value) Value {
+	switch v := args[0].(type) {
+	case Int:
+		if v < 0 {
+			return newInt(new(big.Int).Neg(big.NewInt(int64(v))))
+		}
+		return v
+	case BigInt:
+		return newInt(new(big.Int).Abs(v.x))
+	case Rat:
+		return Rat{new(big.Rat).Abs(v.x)}
+	case Float:
+		return Float(math.Abs(float64(v)))
+	case Decimal:
+		return Decimal{new(big.Int).Abs(v.coef), v.exp}
+	}
+	return Float(cmplx.Abs(complexArg(x, "abs", args)))
+}
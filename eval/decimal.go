@@ -0,0 +1,183 @@
+package eval
+
+import (
+	"errors"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// A Decimal is a floating-point number in base 10, coef × 10^exp. It is
+// the float value of decimal mode, in which decimal fractions such as
+// 0.1 are represented exactly and 0.1 + 0.2 == 0.3. Every operation
+// computes its exact result and rounds it to the interpreter's
+// precision, a number of significant digits, with its rounding mode.
+type Decimal struct {
+	coef *big.Int // without trailing zeros
+	exp  int
+}
+
+func (Decimal) Kind() Kind { return FloatKind }
+
+// String formats a decimal like a Float, with every digit it holds:
+// in positional notation unless its exponent is very small or large.
+func (v Decimal) String() string {
+	digits := new(big.Int).Abs(v.coef).String()
+	sign := ""
+	if v.coef.Sign() < 0 {
+		sign = "-"
+	}
+	adj := len(digits) - 1 + v.exp // exponent in scientific notation
+	switch {
+	case adj < -6 || adj >= 21:
+		s := digits[:1]
+		if len(digits) > 1 {
+			s += "." + digits[1:]
+		}
+		if adj < 0 {
+			return sign + s + "e-" + strconv.Itoa(-adj)
+		}
+		return sign + s + "e+" + strconv.Itoa(adj)
+	case v.exp >= 0:
+		return sign + digits + strings.Repeat("0", v.exp) + ".0"
+	case adj >= 0:
+		return sign + digits[:adj+1] + "." + digits[adj+1:]
+	}
+	return sign + "0." + strings.Repeat("0", -adj-1) + digits
+}
+
+// rat returns the exact value of v.
+func (v Decimal) rat() *big.Rat {
+	r := new(big.Rat).SetInt(v.coef)
+	if v.exp >= 0 {
+		return r.Mul(r, new(big.Rat).SetInt(pow10(v.exp)))
+	}
+	return r.Quo(r, new(big.Rat).SetInt(pow10(-v.exp)))
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// maxDecimalExp bounds the exponents of the float literals and of the
+// results of operators in decimal mode, whose exact values are computed
+// before they are rounded.
+const maxDecimalExp = 100000
+
+// errExponent reports a float literal whose exponent is too large.
+var errExponent = errors.New("exponent too large")
+
+// parseDecimal returns the exact value of a FLOAT literal, such as
+// 1.25 or 3.E+2, as a rational number. The error is errExponent if
+// the exponent of the literal exceeds maxDecimalExp in magnitude, and
+// strconv.ErrSyntax if the literal is malformed.
+func parseDecimal(lit string) (*big.Rat, error) {
+	mant, exp := strings.ToLower(lit), 0
+	if i := strings.IndexByte(mant, 'e'); i >= 0 {
+		n, err := strconv.Atoi(mant[i+1:])
+		if err != nil && err.(*strconv.NumError).Err != strconv.ErrRange {
+			return nil, strconv.ErrSyntax
+		}
+		if err != nil || n > maxDecimalExp || n < -maxDecimalExp {
+			return nil, errExponent
+		}
+		mant, exp = mant[:i], n
+	}
+	if i := strings.IndexByte(mant, '.'); i >= 0 {
+		exp -= len(mant) - i - 1
+		mant = mant[:i] + mant[i+1:]
+	}
+	coef, ok := new(big.Int).SetString(mant, 10)
+	if !ok || mant == "" || mant[0] == '+' || mant[0] == '-' {
+		return nil, strconv.ErrSyntax
+	}
+	return Decimal{coef, exp}.rat(), nil
+}
+
+// roundDecimal rounds x to prec significant decimal digits with the
+// rounding mode.
+func roundDecimal(x *big.Rat, prec uint, mode big.RoundingMode) Decimal {
+	if x.Sign() == 0 {
+		return Decimal{new(big.Int), 0}
+	}
+	num := new(big.Int).Abs(x.Num())
+	den := x.Denom()
+	// Scale |x| by 10^s so that its integer part q has prec digits.
+	// The estimate of s from the lengths of num and den is off by at
+	// most one digit.
+	s := int(prec) - 1 - (len(num.String()) - len(den.String()))
+	var q, r, d *big.Int
+	for {
+		n, m := new(big.Int).Set(num), new(big.Int).Set(den)
+		if s >= 0 {
+			n.Mul(n, pow10(s))
+		} else {
+			m.Mul(m, pow10(-s))
+		}
+		q, r = new(big.Int).QuoRem(n, m, new(big.Int))
+		d = m
+		if q.Sign() > 0 && len(q.String()) >= int(prec) {
+			break
+		}
+		s++
+	}
+	if roundUp(q, r, d, x.Sign() < 0, mode) {
+		q.Add(q, big.NewInt(1))
+	}
+	if x.Sign() < 0 {
+		q.Neg(q)
+	}
+	return normDecimal(q, -s)
+}
+
+// roundUp reports whether the magnitude q of a number with the
+// remainder r/d, 0 <= r < d, is rounded away from zero.
+func roundUp(q, r, d *big.Int, neg bool, mode big.RoundingMode) bool {
+	if r.Sign() == 0 {
+		return false
+	}
+	half := new(big.Int).Lsh(r, 1).Cmp(d) // compares r/d to 1/2
+	switch mode {
+	case big.ToNearestEven:
+		return half > 0 || half == 0 && q.Bit(0) == 1
+	case big.ToNearestAway:
+		return half >= 0
+	case big.ToZero:
+		return false
+	case big.AwayFromZero:
+		return true
+	case big.ToNegativeInf:
+		return neg
+	case big.ToPositiveInf:
+		return !neg
+	}
+	return false
+}
+
+// normDecimal returns coef × 10^exp with the trailing zeros of coef
+// moved into the exponent.
+func normDecimal(coef *big.Int, exp int) Decimal {
+	if coef.Sign() == 0 {
+		return Decimal{coef, 0}
+	}
+	ten := big.NewInt(10)
+	q, r := new(big.Int), new(big.Int)
+	for {
+		q.QuoRem(coef, ten, r)
+		if r.Sign() != 0 {
+			return Decimal{coef, exp}
+		}
+		coef, q = q, coef
+		exp++
+	}
+}
+
+// roundingModes names the rounding modes of decimal mode.
+var roundingModes = map[string]big.RoundingMode{
+	"half-even": big.ToNearestEven,
+	"half-up":   big.ToNearestAway,
+	"down":      big.ToZero,
+	"up":        big.AwayFromZero,
+	"floor":     big.ToNegativeInf,
+	"ceiling":   big.ToPositiveInf,
+}
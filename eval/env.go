@@ -0,0 +1,70 @@
+package eval
+
+import (
+	"fmt"
+	"github.com/jonfk/calc/ast"
+)
+
+// An Env holds the values bound to names in a scope and a link to
+// the immediately surrounding (outer) environment.
+type Env struct {
+	Outer    *Env
+	bindings map[string]*binding
+}
+
+type binding struct {
+	kind  ast.ObjKind // ast.Val, ast.Var or ast.Fun
+	value Value
+}
+
+// NewEnv creates a new environment nested in the outer environment.
+func NewEnv(outer *Env) *Env {
+	return &Env{Outer: outer, bindings: make(map[string]*binding)}
+}
+
+// lookup returns the binding for name, searching the outer
+// environments if it is not found in e.
+func (e *Env) lookup(name string) *binding {
+	for ; e != nil; e = e.Outer {
+		if b, ok := e.bindings[name]; ok {
+			return b
+		}
+	}
+	return nil
+}
+
+// Lookup returns the value bound to name in e or its outer environments.
+func (e *Env) Lookup(name string) (Value, bool) {
+	if b := e.lookup(name); b != nil {
+		return b.value, true
+	}
+	return nil, false
+}
+
+// Bound reports whether name is bound in e itself, ignoring the
+// outer environments.
+func (e *Env) Bound(name string) bool {
+	_, ok := e.bindings[name]
+	return ok
+}
+
+// Define binds name to v in e, shadowing any binding of the same
+// name in the outer environments.
+// kind is ast.Val for immutable bindings and ast.Var for mutable ones.
+func (e *Env) Define(name string, kind ast.ObjKind, v Value) {
+	e.bindings[name] = &binding{kind, v}
+}
+
+// Assign changes the value of the nearest binding of name.
+// It fails if name is not bound or is bound by a val declaration.
+func (e *Env) Assign(name string, v Value) error {
+	b := e.lookup(name)
+	switch {
+	case b == nil:
+		return fmt.Errorf("assignment to undeclared name %s", name)
+	case b.kind != ast.Var:
+		return fmt.Errorf("cannot assign to %s %s", b.kind, name)
+	}
+	b.value = v
+	return nil
+}
@@ -0,0 +1,1020 @@
+// Package eval implements a tree-walking interpreter for calc programs
+// produced by the parse package.
+package eval
+
+import (
+	"fmt"
+	"github.com/jonfk/calc/ast"
+	"github.com/jonfk/calc/lex"
+	"math"
+	"math/big"
+	"math/cmplx"
+	"strconv"
+	"strings"
+)
+
+// An Error describes a failure during evaluation.
+// Pos is the position of the expression that caused it.
+type Error struct {
+	Pos lex.Pos
+	Msg string
+}
+
+func (e *Error) Error() string { return e.Msg }
+
+// An Interpreter evaluates statements and expressions.
+// Top-level declarations are kept in Global between calls so
+// that a program can be evaluated one statement at a time.
+type Interpreter struct {
+	Global *Env
+
+	// Rational selects rational mode, in which the quotient of two
+	// ints is an exact rational number instead of being truncated.
+	Rational bool
+
+	// Digits is the number of digits after the decimal point with
+	// which Format prints rational numbers, or 0 to print them as
+	// fractions.
+	Digits int
+
+	// Decimal selects decimal mode, in which floats are Decimals
+	// rounded to Precision significant digits with the Rounding mode
+	// instead of binary Floats.
+	Decimal   bool
+	Precision uint
+	Rounding  big.RoundingMode
+
+	depth int // number of active function calls
+}
+
+// defaultPrecision is the number of significant digits of decimal mode
+// unless set otherwise, that of the IEEE 754 decimal128 format.
+const defaultPrecision = 34
+
+// maxDepth limits the number of nested function calls so that
+// unbounded recursion is reported instead of exhausting the stack.
+const maxDepth = 10000
+
+// New returns an Interpreter with an empty global environment.
+// The builtin functions are visible in it.
+func New() *Interpreter {
+	return &Interpreter{Global: NewEnv(universe), Precision: defaultPrecision}
+}
+
+// Reset discards all global bindings.
+func (in *Interpreter) Reset() {
+	in.Global = NewEnv(universe)
+}
+
+// EvalFile applies the directives of f and evaluates every statement
+// in f in order and returns the value of the last one. Evaluation
+// stops at the first error.
+func (in *Interpreter) EvalFile(f *ast.File) (v Value, err error) {
+	if err := in.Directives(f); err != nil {
+		return nil, err
+	}
+	for _, s := range f.List {
+		if v, err = in.EvalStmt(s); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// EvalStmt evaluates a single statement in the global environment.
+// Declarations and assignments have no value and return nil.
+func (in *Interpreter) EvalStmt(s ast.Stmt) (v Value, err error) {
+	defer errRecover(&err)
+	return in.stmt(s, in.Global), nil
+}
+
+// EvalExpr evaluates an expression in the global environment.
+func (in *Interpreter) EvalExpr(x ast.Expr) (v Value, err error) {
+	defer errRecover(&err)
+	return in.expr(x, in.Global), nil
+}
+
+// errorf aborts evaluation with an *Error at pos.
+func errorf(pos lex.Pos, format string, args ...interface{}) {
+	panic(&Error{pos, fmt.Sprintf(format, args...)})
+}
+
+// errRecover turns a panic raised by errorf into an error return.
+func errRecover(errp *error) {
+	if r := recover(); r != nil {
+		e, ok := r.(*Error)
+		if !ok {
+			panic(r)
+		}
+		*errp = e
+	}
+}
+
+// --------------------------------------------------------------------------------
+// Statements
+
+func (in *Interpreter) stmt(s ast.Stmt, env *Env) Value {
+	switch s := s.(type) {
+	case *ast.ExprStmt:
+		return in.expr(s.X, env)
+	case *ast.DeclStmt:
+		in.decl(s.Decl, env)
+		return nil
+	case *ast.AssignStmt:
+		ident, ok := s.Lhs.(*ast.Ident)
+		if !ok {
+			errorf(s.Lhs.Pos(), "cannot assign to %s", ast.Sprint(s.Lhs))
+		}
+		v := in.expr(s.Rhs, env)
+		if old, ok := env.Lookup(ident.Tok.Val); ok {
+			// an int assigned to a float var, or a number assigned to
+			// a complex var, is widened
+			switch {
+			case old.Kind() == FloatKind && isExact(v):
+				v = in.float(v)
+			case old.Kind() == ComplexKind && isNumeric(v):
+				v = toComplex(v)
+			}
+		}
+		if err := env.Assign(ident.Tok.Val, v); err != nil {
+			errorf(s.Pos(), "%s", err)
+		}
+		return nil
+	case *ast.BadStmt:
+		errorf(s.Pos(), "bad statement")
+	}
+	errorf(s.Pos(), "unexpected statement %T", s)
+	return nil
+}
+
+func (in *Interpreter) decl(d ast.Decl, env *Env) {
+	switch d := d.(type) {
+	case *ast.GenDecl:
+		spec, ok := d.Spec.(*ast.ValueSpec)
+		if !ok {
+			errorf(d.Pos(), "unexpected spec %T", d.Spec)
+		}
+		kind := ast.Val
+		if d.Tok.Typ == lex.VAR {
+			kind = ast.Var
+		}
+		v := in.expr(spec.Value, env)
+		if spec.Type != nil {
+			v = in.convert(spec.Value.Pos(), v, spec.Type)
+		}
+		if spec.Pattern != nil {
+			bind(spec.Pattern, kind, v, env)
+		} else {
+			env.Define(spec.Name.Tok.Val, kind, v)
+		}
+	case *ast.FuncDecl:
+		fn := newFunc(d.Params, d.Result, d.Body, env)
+		fn.Name = d.Name.Tok.Val
+		env.Define(fn.Name, ast.Fun, fn)
+	default:
+		errorf(d.Pos(), "unexpected declaration %T", d)
+	}
+}
+
+// bind destructures v according to the tuple pattern and binds the
+// names of the pattern in env. The value must have the same shape as
+// the pattern.
+func bind(pattern *ast.TupleExpr, kind ast.ObjKind, v Value, env *Env) {
+	t, ok := v.(Tuple)
+	if !ok {
+		errorf(pattern.Pos(), "cannot destructure %s value %s into %d names", v.Kind(), v, len(pattern.Elts))
+	}
+	if len(t) != len(pattern.Elts) {
+		errorf(pattern.Pos(), "tuple pattern has %d elements but value %s has %d", len(pattern.Elts), v, len(t))
+	}
+	for i, x := range pattern.Elts {
+		switch x := x.(type) {
+		case *ast.Ident:
+			env.Define(x.Tok.Val, kind, t[i])
+		case *ast.TupleExpr:
+			bind(x, kind, t[i], env)
+		default:
+			errorf(x.Pos(), "unexpected %T in tuple pattern", x)
+		}
+	}
+}
+
+// --------------------------------------------------------------------------------
+// Expressions
+
+func (in *Interpreter) expr(x ast.Expr, env *Env) Value {
+	switch x := x.(type) {
+	case *ast.BasicLit:
+		return in.literal(x)
+	case *ast.Ident:
+		v, ok := env.Lookup(x.Tok.Val)
+		if !ok {
+			errorf(x.Pos(), "undefined: %s", x.Tok.Val)
+		}
+		return v
+	case *ast.ParenExpr:
+		if x.X == nil {
+			errorf(x.Pos(), "empty parenthesized expression has no value")
+		}
+		return in.expr(x.X, env)
+	case *ast.UnaryExpr:
+		return unary(x.Op, in.expr(x.X, env))
+	case *ast.BinaryExpr:
+		switch x.Op.Typ {
+		case lex.LAND, lex.LOR:
+			return in.logical(x, env)
+		}
+		return in.binary(x.Op, in.expr(x.X, env), in.expr(x.Y, env))
+	case *ast.BlockExpr:
+		var v Value
+		for _, e := range x.List {
+			v = in.expr(e, env)
+		}
+		return v
+	case *ast.IfExpr:
+		c, ok := in.expr(x.Cond, env).(Bool)
+		if !ok {
+			errorf(x.Cond.Pos(), "non-bool condition in if expression")
+		}
+		if c {
+			return in.expr(x.Body, env)
+		}
+		return in.expr(x.Else, env)
+	case *ast.LetExpr:
+		scope := NewEnv(env)
+		for _, d := range x.Decls {
+			in.decl(d, scope)
+		}
+		return in.expr(x.Body, scope)
+	case *ast.TupleExpr:
+		t := make(Tuple, len(x.Elts))
+		for i, e := range x.Elts {
+			t[i] = in.expr(e, env)
+		}
+		return t
+	case *ast.FuncLit:
+		return newFunc(x.Params, x.Result, x.Body, env)
+	case *ast.CallExpr:
+		return in.call(x, env)
+	case *ast.BadExpr:
+		errorf(x.Pos(), "bad expression")
+	case nil:
+		errorf(lex.NoPos, "missing expression")
+	}
+	errorf(x.Pos(), "unexpected expression %T", x)
+	return nil
+}
+
+// newFunc returns a function closing over env.
+func newFunc(params *ast.FieldList, result ast.Expr, body *ast.BlockExpr, env *Env) *Func {
+	fn := &Func{Result: result, Body: body, Env: env}
+	for _, f := range params.List {
+		fn.Params = append(fn.Params, f.Name.Tok.Val)
+		fn.Types = append(fn.Types, f.Type)
+	}
+	return fn
+}
+
+// convert returns v as a value of the annotated type typ. An int is
+// widened to a float where a float is expected, and an int or a float
+// to a complex where a complex is; any other mismatch is an error
+// reported at pos. The rational numbers of rational mode have the type
+// int to the checker, but one that is not an integer is not accepted
+// as an int.
+func (in *Interpreter) convert(pos lex.Pos, v Value, typ ast.Expr) Value {
+	switch t := typ.(type) {
+	case *ast.Ident:
+		switch {
+		case t.Tok.Val == "float" && isExact(v):
+			return in.float(v)
+		case t.Tok.Val == "complex" && isNumeric(v):
+			return toComplex(v)
+		case t.Tok.Val == "int" && v.Kind() == RatKind:
+			errorf(pos, "cannot use rational number %s as int: not an integer", v)
+		}
+		if v.Kind().String() == t.Tok.Val && v.Kind() != FuncKind && v.Kind() != TupleKind {
+			return v
+		}
+	case *ast.TupleExpr:
+		if tuple, ok := v.(Tuple); ok && len(tuple) == len(t.Elts) {
+			res := make(Tuple, len(tuple))
+			for i, e := range tuple {
+				res[i] = in.convert(pos, e, t.Elts[i])
+			}
+			return res
+		}
+	}
+	errorf(pos, "cannot use %s value %s as %s", v.Kind(), v, typeString(typ))
+	return nil
+}
+
+// typeString returns the source of a type annotation.
+func typeString(typ ast.Expr) string {
+	switch t := typ.(type) {
+	case *ast.Ident:
+		return t.Tok.Val
+	case *ast.TupleExpr:
+		elems := make([]string, len(t.Elts))
+		for i, e := range t.Elts {
+			elems[i] = typeString(e)
+		}
+		return "(" + strings.Join(elems, ", ") + ")"
+	}
+	return "?"
+}
+
+// call evaluates a function call. The arguments are evaluated in the
+// caller's environment and bound to the parameters in a new environment
+// nested in the one the function closes over.
+func (in *Interpreter) call(x *ast.CallExpr, env *Env) Value {
+	v := in.expr(x.Fun, env)
+	if b, ok := v.(*Builtin); ok {
+		if len(x.Args) != b.NumArgs {
+			errorf(x.Pos(), "wrong number of arguments in call to %s: have %d, want %d", b, len(x.Args), b.NumArgs)
+		}
+		args := make([]Value, len(x.Args))
+		for i, arg := range x.Args {
+			args[i] = in.expr(arg, env)
+		}
+		return b.Fn(x, args)
+	}
+	fn, ok := v.(*Func)
+	if !ok {
+		errorf(x.Fun.Pos(), "cannot call non-function %s of kind %s", v, v.Kind())
+	}
+	if len(x.Args) != len(fn.Params) {
+		errorf(x.Pos(), "wrong number of arguments in call to %s: have %d, want %d", fn, len(x.Args), len(fn.Params))
+	}
+	scope := NewEnv(fn.Env)
+	for i, arg := range x.Args {
+		v := in.expr(arg, env)
+		if fn.Types[i] != nil {
+			v = in.convert(arg.Pos(), v, fn.Types[i])
+		}
+		scope.Define(fn.Params[i], ast.Val, v)
+	}
+	if in.depth >= maxDepth {
+		errorf(x.Pos(), "stack overflow in call to %s", fn)
+	}
+	in.depth++
+	defer func() { in.depth-- }()
+	res := in.expr(fn.Body, scope)
+	if fn.Result != nil {
+		res = in.convert(x.Pos(), res, fn.Result)
+	}
+	return res
+}
+
+// literal returns the value denoted by a basic literal.
+func (in *Interpreter) literal(x *ast.BasicLit) Value {
+	switch x.Tok.Typ {
+	case lex.INT:
+		i, err := x.BigIntValue()
+		if err != nil {
+			errorf(x.Pos(), "invalid integer literal %s", x.Tok.Val)
+		}
+		return newInt(i)
+	case lex.FLOAT:
+		if in.Decimal {
+			r, err := parseDecimal(x.Tok.Val)
+			if err == errExponent {
+				errorf(x.Pos(), "exponent of float literal %s too large", x.Tok.Val)
+			} else if err != nil {
+				errorf(x.Pos(), "invalid float literal %s", x.Tok.Val)
+			}
+			return in.round(r)
+		}
+		f, err := strconv.ParseFloat(x.Tok.Val, 64)
+		if err != nil {
+			errorf(x.Pos(), "invalid float literal %s", x.Tok.Val)
+		}
+		return Float(f)
+	case lex.IMAG:
+		f, err := x.ImagValue()
+		if err != nil {
+			errorf(x.Pos(), "invalid imaginary literal %s", x.Tok.Val)
+		}
+		return Complex(complex(0, f))
+	case lex.BOOL:
+		return Bool(x.Tok.Val == "true")
+	case lex.STRING:
+		s, err := x.StringValue()
+		if err != nil {
+			errorf(x.Pos(), "invalid string literal %s", x.Tok.Val)
+		}
+		return String(s)
+	case lex.CHAR:
+		r, err := x.CharValue()
+		if err != nil {
+			errorf(x.Pos(), "invalid character literal %s", x.Tok.Val)
+		}
+		return Char(r)
+	}
+	errorf(x.Pos(), "unexpected literal %s", x.Tok)
+	return nil
+}
+
+// logical evaluates && and || with short-circuiting.
+func (in *Interpreter) logical(x *ast.BinaryExpr, env *Env) Value {
+	l, ok := in.expr(x.X, env).(Bool)
+	if !ok {
+		errorf(x.X.Pos(), "operator %s requires bool operands", x.Op.Val)
+	}
+	if x.Op.Typ == lex.LAND && !bool(l) || x.Op.Typ == lex.LOR && bool(l) {
+		return l
+	}
+	r, ok := in.expr(x.Y, env).(Bool)
+	if !ok {
+		errorf(x.Y.Pos(), "operator %s requires bool operands", x.Op.Val)
+	}
+	return r
+}
+
+func unary(op lex.Token, x Value) Value {
+	switch x := x.(type) {
+	case Int:
+		switch op.Typ {
+		case lex.ADD:
+			return x
+		case lex.SUB:
+			if x == math.MinInt64 {
+				return newInt(new(big.Int).Neg(big.NewInt(int64(x))))
+			}
+			return -x
+		}
+	case BigInt:
+		switch op.Typ {
+		case lex.ADD:
+			return x
+		case lex.SUB:
+			return newInt(new(big.Int).Neg(x.x))
+		}
+	case Rat:
+		switch op.Typ {
+		case lex.ADD:
+			return x
+		case lex.SUB:
+			return Rat{new(big.Rat).Neg(x.x)}
+		}
+	case Float:
+		switch op.Typ {
+		case lex.ADD:
+			return x
+		case lex.SUB:
+			return -x
+		}
+	case Decimal:
+		switch op.Typ {
+		case lex.ADD:
+			return x
+		case lex.SUB:
+			return Decimal{new(big.Int).Neg(x.coef), x.exp}
+		}
+	case Complex:
+		switch op.Typ {
+		case lex.ADD:
+			return x
+		case lex.SUB:
+			return -x
+		}
+	case Bool:
+		if op.Typ == lex.NOT {
+			return !x
+		}
+	}
+	errorf(op.Pos, "invalid operation: operator %s not defined on %s", op.Val, x.Kind())
+	return nil
+}
+
+func (in *Interpreter) binary(op lex.Token, x, y Value) Value {
+	switch {
+	case isExact(x) && isExact(y):
+		return in.exactOp(op, x, y)
+	case isNumeric(x) && isNumeric(y) && !isIntOnly(op):
+		if x.Kind() == ComplexKind || y.Kind() == ComplexKind {
+			return complexOp(op, toComplex(x), toComplex(y))
+		}
+		if in.useDecimal(x, y) {
+			return in.decimalOp(op, toExact(x), toExact(y))
+		}
+		return floatOp(op, toFloat(x), toFloat(y))
+	case x.Kind() == StringKind && y.Kind() == StringKind:
+		return stringOp(op, x.(String), y.(String))
+	case x.Kind() == CharKind && y.Kind() == CharKind:
+		return charOp(op, x.(Char), y.(Char))
+	case x.Kind() == BoolKind && y.Kind() == BoolKind:
+		switch op.Typ {
+		case lex.EQL:
+			return Bool(x == y)
+		case lex.NEQ:
+			return Bool(x != y)
+		}
+	}
+	errorf(op.Pos, "invalid operation: operator %s not defined on %s and %s", op.Val, x.Kind(), y.Kind())
+	return nil
+}
+
+// isIntOnly reports whether op is only defined on ints: div and the
+// bitwise operators.
+func isIntOnly(op lex.Token) bool {
+	switch op.Typ {
+	case lex.DIV, lex.AND, lex.OR, lex.XOR, lex.SHL, lex.SHR:
+		return true
+	}
+	return false
+}
+
+func isNumeric(v Value) bool {
+	switch v.Kind() {
+	case IntKind, RatKind, FloatKind, ComplexKind:
+		return true
+	}
+	return false
+}
+
+// isExact reports whether v is an int or a rational number.
+func isExact(v Value) bool {
+	switch v.Kind() {
+	case IntKind, RatKind:
+		return true
+	}
+	return false
+}
+
+// toFloat converts a numeric value to a Float.
+func toFloat(v Value) Float {
+	switch v := v.(type) {
+	case Int:
+		return Float(v)
+	case BigInt:
+		f, _ := new(big.Float).SetInt(v.x).Float64()
+		return Float(f)
+	case Rat:
+		f, _ := v.x.Float64()
+		return Float(f)
+	case Decimal:
+		f, _ := v.rat().Float64()
+		return Float(f)
+	case Float:
+		return v
+	}
+	panic("eval: toFloat of non-numeric value")
+}
+
+// toComplex converts a numeric value to a Complex.
+func toComplex(v Value) Complex {
+	if c, ok := v.(Complex); ok {
+		return c
+	}
+	return Complex(complex(float64(toFloat(v)), 0))
+}
+
+// toExact returns the exact value of a numeric value as a big.Rat
+// that the caller must not modify. A Float must be finite; its value
+// is that of its shortest decimal representation, so that 0.1 is 1/10.
+func toExact(v Value) *big.Rat {
+	switch v := v.(type) {
+	case Float:
+		r, ok := new(big.Rat).SetString(strconv.FormatFloat(float64(v), 'g', -1, 64))
+		if !ok {
+			panic("eval: toExact of non-finite float")
+		}
+		return r
+	case Decimal:
+		return v.rat()
+	}
+	return toRat(v)
+}
+
+// useDecimal reports whether an operator on the numbers x and y, one
+// of which is a float, is evaluated in decimal: in decimal mode or if
+// one of them is a Decimal, unless one is an infinite or NaN Float.
+func (in *Interpreter) useDecimal(x, y Value) bool {
+	_, xd := x.(Decimal)
+	_, yd := y.(Decimal)
+	return (in.Decimal || xd || yd) && isFinite(x) && isFinite(y)
+}
+
+func isFinite(v Value) bool {
+	f, ok := v.(Float)
+	return !ok || !math.IsInf(float64(f), 0) && !math.IsNaN(float64(f))
+}
+
+// float converts a numeric value to the float of the interpreter's mode.
+func (in *Interpreter) float(v Value) Value {
+	if in.Decimal {
+		return in.round(toExact(v))
+	}
+	return toFloat(v)
+}
+
+// round rounds x to a Decimal with the interpreter's precision and
+// rounding mode.
+func (in *Interpreter) round(x *big.Rat) Decimal {
+	return roundDecimal(x, in.Precision, in.Rounding)
+}
+
+// roundOp rounds the exact result x of op like round. A result whose
+// exponent exceeds maxDecimalExp in magnitude is an error, so that the
+// exact values of later operations stay of a reasonable size.
+func (in *Interpreter) roundOp(op lex.Token, x *big.Rat) Decimal {
+	d := in.round(x)
+	if d.coef.Sign() == 0 {
+		return d
+	}
+	adj := len(new(big.Int).Abs(d.coef).String()) - 1 + d.exp // exponent in scientific notation
+	if adj > maxDecimalExp || adj < -maxDecimalExp {
+		errorf(op.Pos, "decimal result of operator %s out of range", op.Val)
+	}
+	return d
+}
+
+// decimalOp evaluates an operator on numbers of which at least one is
+// a float in decimal mode. The result of arithmetic is rounded once from
+// the exact result.
+func (in *Interpreter) decimalOp(op lex.Token, x, y *big.Rat) Value {
+	switch op.Typ {
+	case lex.ADD:
+		return in.roundOp(op, new(big.Rat).Add(x, y))
+	case lex.SUB:
+		return in.roundOp(op, new(big.Rat).Sub(x, y))
+	case lex.MUL:
+		return in.roundOp(op, new(big.Rat).Mul(x, y))
+	case lex.QUO, lex.REM:
+		if y.Sign() == 0 {
+			errorf(op.Pos, "division by zero")
+		}
+		q := new(big.Rat).Quo(x, y)
+		if op.Typ == lex.QUO {
+			return in.roundOp(op, q)
+		}
+		// x - y*trunc(x/y), which has the sign of x like math.Mod
+		t := new(big.Int).Quo(q.Num(), q.Denom())
+		return in.roundOp(op, new(big.Rat).Sub(x, new(big.Rat).Mul(y, new(big.Rat).SetInt(t))))
+	case lex.POW:
+		// Only integer powers are computed exactly, which the rounding
+		// of the result requires.
+		if !y.IsInt() {
+			errorf(op.Pos, "exponent %s is not an integer: only integer powers are defined in decimal mode", in.round(y))
+		}
+		if x.Sign() == 0 && y.Sign() < 0 {
+			errorf(op.Pos, "division by zero")
+		}
+		if powTooLarge(x, y.Num()) {
+			errorf(op.Pos, "exponent %s too large", y.RatString())
+		}
+		return in.roundOp(op, ratPow(x, y.Num()))
+	}
+	return compare(op, x.Cmp(y))
+}
+
+// toBig converts an int to a big.Int that the caller must not modify.
+func toBig(v Value) *big.Int {
+	switch v := v.(type) {
+	case Int:
+		return big.NewInt(int64(v))
+	case BigInt:
+		return v.x
+	}
+	panic("eval: toBig of non-int value")
+}
+
+// toRat converts an int or a rational number to a big.Rat that the
+// caller must not modify.
+func toRat(v Value) *big.Rat {
+	switch v := v.(type) {
+	case Int:
+		return new(big.Rat).SetInt64(int64(v))
+	case BigInt:
+		return new(big.Rat).SetInt(v.x)
+	case Rat:
+		return v.x
+	}
+	panic("eval: toRat of non-exact value")
+}
+
+// exactOp evaluates an operator on ints and rational numbers. The
+// quotient of two ints is truncated unless in is in rational mode, as
+// is a power with a negative exponent, which is an error otherwise.
+func (in *Interpreter) exactOp(op lex.Token, x, y Value) Value {
+	inverse := op.Typ == lex.POW && toRat(y).Sign() < 0
+	if x.Kind() == RatKind || y.Kind() == RatKind || (op.Typ == lex.QUO || inverse) && in.Rational {
+		return ratOp(op, toRat(x), toRat(y))
+	}
+	if x, ok := x.(Int); ok {
+		if y, ok := y.(Int); ok {
+			return intOp(op, x, y)
+		}
+	}
+	return bigOp(op, toBig(x), toBig(y))
+}
+
+// intOp evaluates an operator on Ints. Results that overflow an Int
+// are computed again with big.Ints.
+func intOp(op lex.Token, x, y Int) Value {
+	switch op.Typ {
+	case lex.ADD:
+		if s := x + y; (s > x) == (y > 0) {
+			return s
+		}
+	case lex.SUB:
+		if d := x - y; (d < x) == (y > 0) {
+			return d
+		}
+	case lex.MUL:
+		p := x * y
+		if x == 0 || p/x == y && !(x == -1 && y == math.MinInt64) {
+			return p
+		}
+	case lex.QUO, lex.DIV, lex.REM:
+		if y == 0 {
+			errorf(op.Pos, "integer division by zero")
+		}
+		if op.Typ == lex.REM {
+			return x % y
+		}
+		if !(x == math.MinInt64 && y == -1) {
+			return x / y
+		}
+	case lex.AND:
+		return x & y
+	case lex.OR:
+		return x | y
+	case lex.XOR:
+		return x ^ y
+	case lex.SHL:
+		if y >= 0 && y < 64 && x<<uint(y)>>uint(y) == x {
+			return x << uint(y)
+		}
+	case lex.SHR:
+		if y >= 64 {
+			y = 63
+		}
+		if y >= 0 {
+			return x >> uint(y)
+		}
+	case lex.POW:
+		// computed with big.Ints
+	default:
+		switch {
+		case x < y:
+			return compare(op, -1)
+		case x > y:
+			return compare(op, 1)
+		}
+		return compare(op, 0)
+	}
+	return bigOp(op, big.NewInt(int64(x)), big.NewInt(int64(y)))
+}
+
+// maxPowBits limits the size in bits of the results of ** and <<, so
+// that a mistyped exponent does not exhaust memory.
+const maxPowBits = 1 << 20
+
+// bigOp evaluates an operator on integers of any size.
+func bigOp(op lex.Token, x, y *big.Int) Value {
+	switch op.Typ {
+	case lex.ADD:
+		return newInt(new(big.Int).Add(x, y))
+	case lex.SUB:
+		return newInt(new(big.Int).Sub(x, y))
+	case lex.MUL:
+		return newInt(new(big.Int).Mul(x, y))
+	case lex.QUO, lex.DIV, lex.REM:
+		if y.Sign() == 0 {
+			errorf(op.Pos, "integer division by zero")
+		}
+		if op.Typ == lex.REM {
+			return newInt(new(big.Int).Rem(x, y))
+		}
+		return newInt(new(big.Int).Quo(x, y))
+	case lex.AND:
+		return newInt(new(big.Int).And(x, y))
+	case lex.OR:
+		return newInt(new(big.Int).Or(x, y))
+	case lex.XOR:
+		return newInt(new(big.Int).Xor(x, y))
+	case lex.SHL, lex.SHR:
+		if y.Sign() < 0 {
+			errorf(op.Pos, "negative shift count %s", y)
+		}
+		if op.Typ == lex.SHR {
+			if !y.IsInt64() || y.Int64() > int64(x.BitLen()) {
+				return newInt(new(big.Int).Rsh(x, uint(x.BitLen())))
+			}
+			return newInt(new(big.Int).Rsh(x, uint(y.Int64())))
+		}
+		if x.Sign() == 0 {
+			return Int(0)
+		}
+		if !y.IsInt64() || y.Int64() > maxPowBits {
+			errorf(op.Pos, "shift count %s too large", y)
+		}
+		return newInt(new(big.Int).Lsh(x, uint(y.Int64())))
+	case lex.POW:
+		if y.Sign() < 0 {
+			errorf(op.Pos, "negative exponent %s in integer power", y)
+		}
+		if powTooLarge(new(big.Rat).SetInt(x), y) {
+			errorf(op.Pos, "exponent %s too large", y)
+		}
+		return newInt(new(big.Int).Exp(x, y, nil))
+	}
+	return compare(op, x.Cmp(y))
+}
+
+// powTooLarge reports whether x ** n has more than about maxPowBits
+// bits in its numerator or denominator.
+func powTooLarge(x *big.Rat, n *big.Int) bool {
+	bits := x.Num().BitLen()
+	if d := x.Denom().BitLen(); d > bits {
+		bits = d
+	}
+	if bits <= 1 { // 0, 1 and -1
+		return false
+	}
+	return !n.IsInt64() || abs64(n.Int64()) > maxPowBits/int64(bits-1)
+}
+
+func abs64(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// ratPow returns x ** n for an integer n that is not too large. x must
+// not be 0 if n is negative.
+func ratPow(x *big.Rat, n *big.Int) *big.Rat {
+	e := new(big.Int).Abs(n)
+	num := new(big.Int).Exp(x.Num(), e, nil)
+	den := new(big.Int).Exp(x.Denom(), e, nil)
+	if n.Sign() < 0 {
+		num, den = den, num
+	}
+	return new(big.Rat).SetFrac(num, den)
+}
+
+// ratOp evaluates an operator on rational numbers. The remainder and
+// the bitwise operators are only defined on ints, so they fail on a
+// rational number that is not an integer; the quotient of div
+// is truncated, and an exponent must be an integer.
+func ratOp(op lex.Token, x, y *big.Rat) Value {
+	switch op.Typ {
+	case lex.ADD:
+		return newRat(new(big.Rat).Add(x, y))
+	case lex.SUB:
+		return newRat(new(big.Rat).Sub(x, y))
+	case lex.MUL:
+		return newRat(new(big.Rat).Mul(x, y))
+	case lex.QUO:
+		if y.Sign() == 0 {
+			errorf(op.Pos, "division by zero")
+		}
+		return newRat(new(big.Rat).Quo(x, y))
+	case lex.DIV:
+		if y.Sign() == 0 {
+			errorf(op.Pos, "integer division by zero")
+		}
+		q := new(big.Rat).Quo(x, y)
+		return newInt(new(big.Int).Quo(q.Num(), q.Denom()))
+	case lex.POW:
+		if !y.IsInt() {
+			errorf(op.Pos, "exponent %s is not an integer", y.RatString())
+		}
+		if x.Sign() == 0 && y.Sign() < 0 {
+			errorf(op.Pos, "division by zero")
+		}
+		if powTooLarge(x, y.Num()) {
+			errorf(op.Pos, "exponent %s too large", y.RatString())
+		}
+		return newRat(ratPow(x, y.Num()))
+	case lex.REM, lex.AND, lex.OR, lex.XOR, lex.SHL, lex.SHR:
+		if x.IsInt() {
+			x = y
+		}
+		errorf(op.Pos, "invalid operation: operator %s requires ints, have rational number %s", op.Val, x.RatString())
+	}
+	return compare(op, x.Cmp(y))
+}
+
+func floatOp(op lex.Token, x, y Float) Value {
+	switch op.Typ {
+	case lex.ADD:
+		return x + y
+	case lex.SUB:
+		return x - y
+	case lex.MUL:
+		return x * y
+	case lex.QUO:
+		return x / y
+	case lex.REM:
+		return Float(math.Mod(float64(x), float64(y)))
+	case lex.POW:
+		return Float(math.Pow(float64(x), float64(y)))
+	}
+	switch {
+	case x < y:
+		return compare(op, -1)
+	case x > y:
+		return compare(op, 1)
+	case x == y:
+		return compare(op, 0)
+	}
+	// NaN is unordered and unequal to everything.
+	switch op.Typ {
+	case lex.EQL, lex.LSS, lex.LEQ, lex.GTR, lex.GEQ:
+		return Bool(false)
+	case lex.NEQ:
+		return Bool(true)
+	}
+	return compare(op, 0)
+}
+
+// complexOp evaluates an operator on complex numbers, which are only
+// compared for equality.
+func complexOp(op lex.Token, x, y Complex) Value {
+	switch op.Typ {
+	case lex.ADD:
+		return x + y
+	case lex.SUB:
+		return x - y
+	case lex.MUL:
+		return x * y
+	case lex.QUO:
+		return x / y
+	case lex.POW:
+		return complexPow(x, y)
+	case lex.EQL:
+		return Bool(x == y)
+	case lex.NEQ:
+		return Bool(x != y)
+	}
+	errorf(op.Pos, "invalid operation: operator %s not defined on complex", op.Val)
+	return nil
+}
+
+// complexPow returns x ** y. A power with a small integer exponent is
+// computed by repeated multiplication, so that 1i ** 2 is exactly -1.
+func complexPow(x, y Complex) Complex {
+	n := real(y)
+	if x == 0 || imag(y) != 0 || n != math.Trunc(n) || math.Abs(n) > 1<<10 {
+		return Complex(cmplx.Pow(complex128(x), complex128(y)))
+	}
+	p, e := Complex(1), int(math.Abs(n))
+	for ; e > 0; e >>= 1 {
+		if e&1 == 1 {
+			p *= x
+		}
+		x *= x
+	}
+	if n < 0 {
+		return 1 / p
+	}
+	return p
+}
+
+// stringOp evaluates concatenation and the comparison operators,
+// which compare strings byte-wise.
+func stringOp(op lex.Token, x, y String) Value {
+	switch op.Typ {
+	case lex.ADD:
+		return x + y
+	case lex.EQL, lex.NEQ, lex.LSS, lex.LEQ, lex.GTR, lex.GEQ:
+		return compare(op, strings.Compare(string(x), string(y)))
+	}
+	errorf(op.Pos, "invalid operation: operator %s not defined on string", op.Val)
+	return nil
+}
+
+// charOp evaluates the comparison operators, which compare
+// characters by code point.
+func charOp(op lex.Token, x, y Char) Value {
+	switch op.Typ {
+	case lex.EQL, lex.NEQ, lex.LSS, lex.LEQ, lex.GTR, lex.GEQ:
+		return compare(op, int(x-y))
+	}
+	errorf(op.Pos, "invalid operation: operator %s not defined on char", op.Val)
+	return nil
+}
+
+// compare evaluates a comparison operator given the result c of
+// comparing its operands: -1 if x < y, 0 if x == y, +1 if x > y.
+func compare(op lex.Token, c int) Value {
+	switch op.Typ {
+	case lex.EQL:
+		return Bool(c == 0)
+	case lex.NEQ:
+		return Bool(c != 0)
+	case lex.LSS:
+		return Bool(c < 0)
+	case lex.LEQ:
+		return Bool(c <= 0)
+	case lex.GTR:
+		return Bool(c > 0)
+	case lex.GEQ:
+		return Bool(c >= 0)
+	}
+	errorf(op.Pos, "invalid operation: unknown operator %s", op.Val)
+	return nil
+}
@@ -0,0 +1,670 @@
+package eval
+
+import (
+	"github.com/jonfk/calc/parse"
+	"math/big"
+	"testing"
+)
+
+// evalString parses and evaluates input with a fresh Interpreter.
+func evalString(name, input string) (Value, error) {
+	parser := parse.Parse(name, input)
+	return New().EvalFile(parser.File)
+}
+
+func TestEvalArithmetic(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Value
+	}{
+		{`4+4`, Int(8)},
+		{`7-4+2`, Int(5)},
+		{`2*3+4`, Int(10)},
+		{`2*(3+4)`, Int(14)},
+		{`-1 + 2`, Int(1)},
+		{`-2*3 + 1`, Int(-5)},
+		{`-(1 + 2)`, Int(-3)},
+		{`7/2`, Int(3)},
+		{`7%3`, Int(1)},
+		{`7.0/2`, Float(3.5)},
+		{`1.5+1`, Float(2.5)},
+		{`10.%4.`, Float(2)},
+		{`-2`, Int(-2)},
+		{`-(3)*2`, Int(-6)},
+		{`0x1f+0b11`, Int(34)},
+		{`0c17 + 017`, Int(32)},
+		{`1_000 * 0x_ff`, Int(255000)},
+		{`-9223372036854775807`, Int(-9223372036854775807)},
+		{`2 ** 10`, Int(1024)},
+		{`2 ** 3 ** 2`, Int(512)},
+		{`-2 ** 2`, Int(-4)},
+		{`(-2) ** 3`, Int(-8)},
+		{`-2 * 3 ** 2`, Int(-18)},
+		{`2.0 ** -1`, Float(0.5)},
+		{`4 ** 0.5`, Float(2)},
+		{`7 div 2`, Int(3)},
+		{`-7 div 2`, Int(-3)},
+		{`0xf0 | 0x0f`, Int(255)},
+		{`0xff & 0x0f`, Int(15)},
+		{`6 ^ 3`, Int(5)},
+		{`1 << 4 | 1`, Int(17)},
+		{`-8 >> 1`, Int(-4)},
+		{`-1 >> 100`, Int(-1)},
+		{`1 + 2 & 3`, Int(3)},
+	}
+	for _, test := range tests {
+		output, err := evalString("TestEvalArithmetic", test.input)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.input, err)
+			continue
+		}
+		if output != test.expected {
+			t.Errorf("%s:\nExpected: %s\nGot:      %s\n", test.input, test.expected, output)
+		}
+	}
+}
+
+func TestEvalComparisonAndLogic(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Value
+	}{
+		{`8 == 99`, Bool(false)},
+		{`2 <= 3`, Bool(true)},
+		{`3.4 >= 3.5`, Bool(false)},
+		{`9.0 != 3.`, Bool(true)},
+		{`9 < 10`, Bool(true)},
+		{`3 > 2.5`, Bool(true)},
+		{`!(8 == 0)`, Bool(true)},
+		{`!true && false`, Bool(false)},
+		{`!false || true`, Bool(true)},
+		{`!(false || true)`, Bool(false)},
+		{`true || false && false`, Bool(true)},
+		{`true == false`, Bool(false)},
+		{`false && undefinedName`, Bool(false)},
+		{`true || undefinedName`, Bool(true)},
+	}
+	for _, test := range tests {
+		output, err := evalString("TestEvalComparisonAndLogic", test.input)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.input, err)
+			continue
+		}
+		if output != test.expected {
+			t.Errorf("%s:\nExpected: %s\nGot:      %s\n", test.input, test.expected, output)
+		}
+	}
+}
+
+func TestEvalIfExpr(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Value
+	}{
+		{`if true then 1 else 2 end`, Int(1)},
+		{`if 1 > 2 then 1 else 2 end`, Int(2)},
+		{"if true then\n 1\n 2 + 3\nelse 4 end", Int(5)},
+		{`1 + if false then 2 else 3 end * 4`, Int(13)},
+		{`if true then if false then 1 else 2 end else 3 end`, Int(2)},
+		{`if false then 1/0 else 1 end`, Int(1)},
+	}
+	for _, test := range tests {
+		output, err := evalString("TestEvalIfExpr", test.input)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.input, err)
+			continue
+		}
+		if output != test.expected {
+			t.Errorf("%s:\nExpected: %s\nGot:      %s\n", test.input, test.expected, output)
+		}
+	}
+}
+
+func TestEvalLetExpr(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Value
+	}{
+		{`let val a = 2 in a * 3 end`, Int(6)},
+		{`let val a = 2; val b = a + 1 in a * b end`, Int(6)},
+		{"val a = 1\nlet val a = 10 in a end + a", Int(11)},
+		{"let var a = 1\nin\n a + 1\n a\nend", Int(1)},
+		{`let val a = 1 in let val a = a + 1 in a end end`, Int(2)},
+	}
+	for _, test := range tests {
+		output, err := evalString("TestEvalLetExpr", test.input)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.input, err)
+			continue
+		}
+		if output != test.expected {
+			t.Errorf("%s:\nExpected: %s\nGot:      %s\n", test.input, test.expected, output)
+		}
+	}
+}
+
+func TestEvalFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Value
+	}{
+		{"val sq = fn (x) => x * x end\nsq(3) + 1", Int(10)},
+		{"def fact(n) = if n <= 1 then 1 else n * fact(n - 1) end end\nfact(10)", Int(3628800)},
+		{"def adder(n) = fn (x) => x + n end end\nval add2 = adder(2)\nadd2(5)", Int(7)},
+		{`(fn (a, b) => a - b end)(5, 3)`, Int(2)},
+		{"def adder(n) = fn (x) => x + n end end\nadder(1)(2)", Int(3)},
+		{`(fn () => 4 end)()`, Int(4)},
+		// closures capture their defining scope, not the caller's
+		{"val a = 1\ndef f() = a end\nlet val a = 2 in f() end", Int(1)},
+		{"var n = 1\ndef get() = n end\nn = 5\nget()", Int(5)},
+	}
+	for _, test := range tests {
+		output, err := evalString("TestEvalFunctions", test.input)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.input, err)
+			continue
+		}
+		if output != test.expected {
+			t.Errorf("%s:\nExpected: %s\nGot:      %s\n", test.input, test.expected, output)
+		}
+	}
+}
+
+func TestEvalTuples(t *testing.T) {
+	// tuples are not comparable so the results are compared as strings
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`(1, 2 + 3, "x")`, `(1, 5, "x")`},
+		{`((1, 2), (3))`, `((1, 2), 3)`},
+		{"val (a, b) = (1, 2)\na - b", `-1`},
+		{"val ((a, b), c) = ((1, 2), 3)\n(c, b, a)", `(3, 2, 1)`},
+		{"def swap(p) = let val (x, y) = p in (y, x) end end\nswap((1, 2))", `(2, 1)`},
+		{"var (a, b) = (1, 2)\na = 3\n(a, b)", `(3, 2)`},
+	}
+	for _, test := range tests {
+		output, err := evalString("TestEvalTuples", test.input)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.input, err)
+			continue
+		}
+		if output.String() != test.expected {
+			t.Errorf("%s:\nExpected: %s\nGot:      %s\n", test.input, test.expected, output)
+		}
+	}
+}
+
+func TestEvalStrings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Value
+	}{
+		{`"a\"b"`, String(`a"b`)},
+		{`"a\tb\n"`, String("a\tb\n")},
+		{`"\x41\u00e9"`, String("Aé")},
+		{`"ab" + "cd"`, String("abcd")},
+		{`"ab" == "ab"`, Bool(true)},
+		{`"ab" != "ab"`, Bool(false)},
+		{`"ab" < "b"`, Bool(true)},
+		{`"b" >= "ab"`, Bool(true)},
+		{`len("héllo")`, Int(5)},
+		{`len("")`, Int(0)},
+		{`len((1, "a", 2))`, Int(3)},
+		{"val len = 3\nlen", Int(3)},
+	}
+	for _, test := range tests {
+		output, err := evalString("TestEvalStrings", test.input)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.input, err)
+			continue
+		}
+		if output != test.expected {
+			t.Errorf("%s:\nExpected: %s\nGot:      %s\n", test.input, test.expected, output)
+		}
+	}
+}
+
+func TestEvalChars(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Value
+	}{
+		{`'a'`, Char('a')},
+		{`'\n'`, Char('\n')},
+		{`'é'`, Char('é')},
+		{`'\''`, Char('\'')},
+		{`'a' == 'a'`, Bool(true)},
+		{`'a' != 'b'`, Bool(true)},
+		{`'a' < 'b'`, Bool(true)},
+		{`'é' <= 'e'`, Bool(false)},
+		{`int('a')`, Int(97)},
+		{`int('\u00e9')`, Int(233)},
+		{`char(97)`, Char('a')},
+		{`char(int('a') + 1)`, Char('b')},
+		{`char('x')`, Char('x')},
+	}
+	for _, test := range tests {
+		output, err := evalString("TestEvalChars", test.input)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.input, err)
+			continue
+		}
+		if output != test.expected {
+			t.Errorf("%s:\nExpected: %s\nGot:      %s\n", test.input, test.expected, output)
+		}
+	}
+}
+
+func TestEvalLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Value
+	}{
+		{`10`, Int(10)},
+		{`6.0`, Float(6)},
+		{`2.0e1`, Float(20)},
+		{`true`, Bool(true)},
+		{`"aoeu"`, String("aoeu")},
+	}
+	for _, test := range tests {
+		output, err := evalString("TestEvalLiterals", test.input)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.input, err)
+			continue
+		}
+		if output != test.expected {
+			t.Errorf("%s:\nExpected: %s\nGot:      %s\n", test.input, test.expected, output)
+		}
+	}
+}
+
+func TestEvalAnnotations(t *testing.T) {
+	// results are compared as strings so that 1 and 1.0 differ
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"val x: int = 3\nx / 2", "1"},
+		{"val x: float = 3\nx / 2", "1.5"},
+		{"val t: (float, int) = (1, 2)\nt", "(1.0, 2)"},
+		{"val (a, b): (float, int) = (1, 2)\n(a, b)", "(1.0, 2)"},
+		{"def half(x: float) = x / 2 end\nhalf(3)", "1.5"},
+		{"def three(): float = 3 end\nthree() / 2", "1.5"},
+		{"val f = fn (x: float, n: int): float => x * n end\nf(1, 2)", "2.0"},
+		{"var x = 1.5\nx = 2\nx / 4", "0.5"},
+		{"var x = 1\nx = 2\nx / 4", "0"},
+	}
+	for _, test := range tests {
+		output, err := evalString("TestEvalAnnotations", test.input)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.input, err)
+			continue
+		}
+		if output.String() != test.expected {
+			t.Errorf("%s:\nExpected: %s\nGot:      %s\n", test.input, test.expected, output)
+		}
+	}
+}
+
+func TestEvalBigInts(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`9223372036854775807 + 1`, "9223372036854775808"},
+		{`(0 - 9223372036854775807) - 2`, "-9223372036854775809"},
+		{`4294967296 * 4294967296 * 4294967296`, "79228162514264337593543950336"},
+		{`(0 - 9223372036854775807 - 1) / (0 - 1)`, "9223372036854775808"},
+		{`-(0 - 9223372036854775807 - 1)`, "9223372036854775808"},
+		{`123456789012345678901234567890 % 1000`, "890"},
+		{`100000000000000000000 - 99999999999999999999`, "1"},
+		{`100000000000000000000 > 9223372036854775807`, "true"},
+		{`100000000000000000000 / 2.0`, "5e+19"},
+		{`int(100000000000000000000)`, "100000000000000000000"},
+	}
+	for _, test := range tests {
+		output, err := evalString("TestEvalBigInts", test.input)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.input, err)
+			continue
+		}
+		if output.String() != test.expected {
+			t.Errorf("%s:\nExpected: %s\nGot:      %s\n", test.input, test.expected, output)
+		}
+	}
+
+	// a BigInt result that fits in an Int is an Int
+	if v, _ := evalString("TestEvalBigInts", `100000000000000000000 / 100000000000000000000`); v != Int(1) {
+		t.Errorf("Expected Int(1), got %#v", v)
+	}
+}
+
+func TestEvalRational(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		decimal  string
+	}{
+		{`1/3 + 1/3 + 1/3`, "1", "1"},
+		{`1/3 + 1/6`, "1/2", "0.5"},
+		{`(2/3, 0 - 2/3)`, "(2/3, -2/3)", "(0.6666666667, -0.6666666667)"},
+		{`7 % 4`, "3", "3"},
+		{`1/3 < 1/2`, "true", "true"},
+		{`int(7/2)`, "3", "3"},
+		{`1/4 * 2.0`, "0.5", "0.5"},
+		{`val x: float = 1/4` + "\nx", "0.25", "0.25"},
+		{`100000000000000000000/3`, "100000000000000000000/3", "33333333333333333333.3333333333"},
+	}
+	for _, test := range tests {
+		in := New()
+		in.Rational = true
+		parser := parse.Parse("TestEvalRational", test.input)
+		output, err := in.EvalFile(parser.File)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.input, err)
+			continue
+		}
+		if s := in.Format(output); s != test.expected {
+			t.Errorf("%s:\nExpected: %s\nGot:      %s\n", test.input, test.expected, s)
+		}
+		in.Digits = 10
+		if s := in.Format(output); s != test.decimal {
+			t.Errorf("%s printed as a decimal:\nExpected: %s\nGot:      %s\n", test.input, test.decimal, s)
+		}
+	}
+
+	in := New()
+	in.Rational = true
+	errors := []struct {
+		input string
+		msg   string
+	}{
+		{`1/0`, "division by zero"},
+		{`(1/2) % 2`, "invalid operation: operator % requires ints, have rational number 1/2"},
+		{`(1/2) % 1`, "invalid operation: operator % requires ints, have rational number 1/2"},
+		{`(1/2) & 1`, "invalid operation: operator & requires ints, have rational number 1/2"},
+		{`(1/2) ^ 1`, "invalid operation: operator ^ requires ints, have rational number 1/2"},
+		{`1 << (1/2)`, "invalid operation: operator << requires ints, have rational number 1/2"},
+		{`val x: int = 1/2`, "cannot use rational number 1/2 as int: not an integer"},
+		{`val t: (int, float) = (1/2, 1/2)`, "cannot use rational number 1/2 as int: not an integer"},
+		{`char(65/2)`, "cannot convert rational number 65/2 to char: not an integer"},
+	}
+	for _, test := range errors {
+		parser := parse.Parse("TestEvalRational", test.input)
+		if _, err := in.EvalFile(parser.File); err == nil || err.Error() != test.msg {
+			t.Errorf("%s: expected error %q, got %v", test.input, test.msg, err)
+		}
+	}
+}
+
+func TestEvalComplex(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`3i`, "(0+3i)"},
+		{`1 + 2.5i`, "(1+2.5i)"},
+		{`(1 + 2i) * (3 - 1i)`, "(5+5i)"},
+		{`(1 + 2i) / 2`, "(0.5+1i)"},
+		{`1i * 1i == -1`, "true"},
+		{`1i ** 2`, "(-1+0i)"},
+		{`(1 + 1i) ** -2`, "(0-0.5i)"},
+		{`1.5 != 1.5 + 0i`, "false"},
+		{`-(1 + 1i)`, "(-1-1i)"},
+		{"var c = 1i\nc = 3\nc / 2", "(1.5+0i)"},
+		{"var c = 1i\nc = 2.5\nc", "(2.5+0i)"},
+		{`real(3 + 4i)`, "3.0"},
+		{`imag(3 + 4i)`, "4.0"},
+		{`imag(2)`, "0.0"},
+		{`abs(3 + 4i)`, "5.0"},
+		{`abs(-3)`, "3"},
+		{`abs(-2.5)`, "2.5"},
+		{`abs(-9223372036854775807 - 1)`, "9223372036854775808"},
+		{`conj(3 + 4i)`, "(3-4i)"},
+		{`phase(-1)`, "3.141592653589793"},
+		{"val z: complex = 2\nz", "(2+0i)"},
+		{"def sq(x) = x * x end\nsq(2i)", "(-4+0i)"},
+	}
+	for _, test := range tests {
+		output, err := evalString("TestEvalComplex", test.input)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.input, err)
+			continue
+		}
+		if output.String() != test.expected {
+			t.Errorf("%s:\nExpected: %s\nGot:      %s\n", test.input, test.expected, output)
+		}
+	}
+}
+
+func TestEvalDecimal(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`0.1 + 0.2`, "0.3"},
+		{`0.1 + 0.2 == 0.3`, "true"},
+		{`1.10 * 3`, "3.3"},
+		{`1.0 / 3`, "0.3333333333333333333333333333333333"},
+		{`2.0 / 3`, "0.6666666666666666666666666666666667"},
+		{`10.5 % 3`, "1.5"},
+		{`(0 - 10.5) % 3`, "-1.5"},
+		{`1e30 + 1`, "1.000000000000000000000000000001e+30"},
+		{`1e-9 * 1.5`, "1.5e-9"},
+		{`0.000001 * 1`, "0.000001"},
+		{`12e2`, "1200.0"},
+		{`3.`, "3.0"},
+		{`-2.50`, "-2.5"},
+		{`val x: float = 3` + "\nx / 4", "0.75"},
+		{`var x = 1.5` + "\nx = 2\nx", "2.0"},
+		{`(1.5, 2)`, "(1.5, 2)"},
+		{`1e100000 * 1e-100000`, "1.0"},
+		{`1.1 ** 2`, "1.21"},
+		{`2.0 ** -2`, "0.25"},
+		{`(2.0 / 3) ** 2`, "0.4444444444444444444444444444444445"},
+	}
+	for _, test := range tests {
+		in := New()
+		in.Decimal = true
+		parser := parse.Parse("TestEvalDecimal", test.input)
+		output, err := in.EvalFile(parser.File)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.input, err)
+			continue
+		}
+		if s := output.String(); s != test.expected {
+			t.Errorf("%s:\nExpected: %s\nGot:      %s\n", test.input, test.expected, s)
+		}
+	}
+
+	errors := []struct {
+		input string
+		pos   int // byte offset of the error
+		msg   string
+	}{
+		{`1.0 / 0`, 4, "division by zero"},
+		{`1 + 1e100000000`, 4, "exponent of float literal 1e100000000 too large"},
+		{`1e-99999999999`, 0, "exponent of float literal 1e-99999999999 too large"},
+		{`1e99999999999999999999`, 0, "exponent of float literal 1e99999999999999999999 too large"},
+		{`1e100000 * 1e100000`, 9, "decimal result of operator * out of range"},
+		{`1e-100000 / 1e100000`, 10, "decimal result of operator / out of range"},
+		{`2.0 ** 0.5`, 4, "exponent 0.5 is not an integer: only integer powers are defined in decimal mode"},
+		{`0.0 ** -1`, 4, "division by zero"},
+		{`1.1 ** 10000000`, 4, "exponent 10000000 too large"},
+	}
+	for _, test := range errors {
+		in := New()
+		in.Decimal = true
+		parser := parse.Parse("TestEvalDecimal", test.input)
+		_, err := in.EvalFile(parser.File)
+		if e, ok := err.(*Error); !ok || int(e.Pos) != test.pos || e.Msg != test.msg {
+			t.Errorf("%s: expected error %q at %d, got %v", test.input, test.msg, test.pos, err)
+		}
+	}
+}
+
+func TestDecimalRounding(t *testing.T) {
+	tests := []struct {
+		rounding string
+		inputs   [4]string // 2/3, -2/3, 0.125 and 0.135 rounded to 2 digits
+	}{
+		{"half-even", [4]string{"0.67", "-0.67", "0.12", "0.14"}},
+		{"half-up", [4]string{"0.67", "-0.67", "0.13", "0.14"}},
+		{"down", [4]string{"0.66", "-0.66", "0.12", "0.13"}},
+		{"up", [4]string{"0.67", "-0.67", "0.13", "0.14"}},
+		{"floor", [4]string{"0.66", "-0.67", "0.12", "0.13"}},
+		{"ceiling", [4]string{"0.67", "-0.66", "0.13", "0.14"}},
+	}
+	for _, test := range tests {
+		for i, input := range []string{`2.0 / 3`, `(0 - 2.0) / 3`, `0.125`, `0.135`} {
+			in := New()
+			parser := parse.Parse("TestDecimalRounding", "//calc:float decimal\n//calc:precision 2\n//calc:rounding "+test.rounding+"\n"+input)
+			output, err := in.EvalFile(parser.File)
+			if err != nil {
+				t.Errorf("%s: unexpected error: %s", input, err)
+				continue
+			}
+			if s := output.String(); s != test.inputs[i] {
+				t.Errorf("%s rounded %s: expected %s, got %s", input, test.rounding, test.inputs[i], s)
+			}
+		}
+	}
+}
+
+func TestDirectives(t *testing.T) {
+	input := `1/3
+// not a directive
+//calc:print decimal 3
+//calc:mode rational`
+	in := New()
+	parser := parse.Parse("TestDirectives", input)
+	output, err := in.EvalFile(parser.File)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if s := in.Format(output); s != "0.333" {
+		t.Errorf("Expected 0.333, got %s", s)
+	}
+
+	for _, input := range []string{"//calc:", "//calc:mode", "//calc:print decimal 0", "//calc:speed fast",
+		"//calc:float hex", "//calc:precision 0", "//calc:rounding sideways"} {
+		parser := parse.Parse("TestDirectives", "1\n"+input)
+		if _, err := New().EvalFile(parser.File); err == nil {
+			t.Errorf("%s: expected an error", input)
+		} else if e, ok := err.(*Error); !ok || e.Pos != 2 {
+			t.Errorf("%s: expected an *Error at 2, got %v", input, err)
+		}
+	}
+}
+
+func TestEvalDeclarations(t *testing.T) {
+	in := New()
+	for _, input := range []string{`val a = 3`, `var b = a * 2`, `b = b + a`} {
+		parser := parse.Parse("TestEvalDeclarations", input)
+		if _, err := in.EvalFile(parser.File); err != nil {
+			t.Fatalf("%s: unexpected error: %s", input, err)
+		}
+	}
+	if v, _ := in.Global.Lookup("b"); v != Int(9) {
+		t.Errorf("Expected b to be 9, got %s", v)
+	}
+
+	parser := parse.Parse("TestEvalDeclarations", `a = 4`)
+	if _, err := in.EvalFile(parser.File); err == nil {
+		t.Errorf("Expected error when assigning to a val")
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		pos   int // byte offset of the error
+	}{
+		{`1/0`, 1},
+		{`1 div 0`, 2},
+		{`2 ** -1`, 2},
+		{`2 ** 10000000`, 2},
+		{`1 << -1`, 2},
+		{`1.5 div 1`, 4},
+		{`1.0 & 1`, 4},
+		{`1i < 2i`, 3},
+		{`1i % 2`, 3},
+		{`abs("a")`, 4},
+		{`(abs)("a")`, 6},
+		{`(real)("a")`, 7},
+		{`true + 1`, 5},
+		{`-true`, 0},
+		{`!1`, 0},
+		{`4 + x`, 4},
+		{`1 && true`, 0},
+		{`x = 1`, 0},
+		{`if 1 then 2 else 3 end`, 3},
+		{"let val a = 1 in a end\na", 23},
+		{"val f = fn (a) => a end\nf(1, 2)", 24},
+		{"val g = 3\ng(1)", 10},
+		{"def f() = 1 end\nf = 2", 16},
+		{"def loop(n) = loop(n + 1) end\nloop(0)", 14},
+		{`val (a, b) = (1, 2, 3)`, 4},
+		{`val (a, (b, c)) = (1, 2)`, 8},
+		{`val (a, b) = 1`, 4},
+		{`(1, 2) + 1`, 7},
+		{`"a" - "b"`, 4},
+		{`"a" + 1`, 4},
+		{`len(1)`, 4},
+		{`len("a", "b")`, 0},
+		{`len = 1`, 0},
+		{`'a' + 1`, 4},
+		{`'a' + 'b'`, 4},
+		{`int("a")`, 4},
+		{`char(-1)`, 5},
+		{`char(55296)`, 5},
+		{`val x: int = 2.5`, 13},
+		{`val t: (int, string) = (1, 2)`, 23},
+		{"def f(x: bool) = x end\nf(1)", 25},
+		{"def f(): string = 1 end\nf()", 24},
+	}
+	for _, test := range tests {
+		_, err := evalString("TestEvalErrors", test.input)
+		e, ok := err.(*Error)
+		if !ok {
+			t.Errorf("%s: expected *Error, got %v", test.input, err)
+			continue
+		}
+		if int(e.Pos) != test.pos {
+			t.Errorf("%s: expected error at %d, got %d (%s)", test.input, test.pos, e.Pos, e)
+		}
+	}
+}
+
+func TestValueString(t *testing.T) {
+	tests := []struct {
+		value    Value
+		expected string
+	}{
+		{Int(-3), "-3"},
+		{Float(6), "6.0"},
+		{Float(0.5), "0.5"},
+		{Float(1e21), "1e+21"},
+		{Complex(complex(1, -2.5)), "(1-2.5i)"},
+		{Bool(true), "true"},
+		{String("a\"b"), `"a\"b"`},
+		{Char('a'), `'a'`},
+		{Char('\n'), `'\n'`},
+		{BigInt{new(big.Int).Lsh(big.NewInt(1), 64)}, "18446744073709551616"},
+		{Rat{big.NewRat(-1, 3)}, "-1/3"},
+		{Decimal{big.NewInt(-25), -1}, "-2.5"},
+		{Decimal{big.NewInt(3), 2}, "300.0"},
+		{Decimal{big.NewInt(15), -8}, "1.5e-7"},
+		{Decimal{big.NewInt(15), -7}, "0.0000015"},
+		{Decimal{big.NewInt(1), 21}, "1e+21"},
+		{Tuple{Int(1), Tuple{Bool(false), String("x")}}, `(1, (false, "x"))`},
+		{&Func{Params: []string{"a", "b"}}, "fn(a, b)"},
+		{&Func{Name: "f"}, "def f()"},
+	}
+	for _, test := range tests {
+		if s := test.value.String(); s != test.expected {
+			t.Errorf("Expected %s, got %s", test.expected, s)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package eval
+
+import (
+	"fmt"
+	"github.com/jonfk/calc/ast"
+	"strconv"
+	"strings"
+)
+
+// defaultDigits is the number of digits after the decimal point of
+// rational numbers printed as decimals when none is given.
+const defaultDigits = 10
+
+// SetOption sets an option of the interpreter, as given by a session
+// command or a directive. The options are
+//
+//	mode int                truncate the quotient of two ints (the default)
+//	mode rational           make the quotient of two ints an exact rational number
+//	print fraction          print rational numbers as fractions such as 1/3 (the default)
+//	print decimal [digits]  print rational numbers as decimals rounded to
+//	                        digits places after the point, 10 by default
+//	float binary            make floats 64-bit binary floating-point numbers (the default)
+//	float decimal           make floats decimal numbers
+//	precision digits        round decimal floats to digits significant digits, 34 by default
+//	rounding mode           round decimal floats with mode: half-even (the
+//	                        default), half-up, down, up, floor or ceiling
+func (in *Interpreter) SetOption(name string, args ...string) error {
+	invalid := fmt.Errorf("invalid arguments for option %s: %q", name, strings.Join(args, " "))
+	switch name {
+	case "mode":
+		switch {
+		case len(args) == 1 && args[0] == "int":
+			in.Rational = false
+		case len(args) == 1 && args[0] == "rational":
+			in.Rational = true
+		default:
+			return invalid
+		}
+	case "print":
+		switch {
+		case len(args) == 1 && args[0] == "fraction":
+			in.Digits = 0
+		case len(args) == 1 && args[0] == "decimal":
+			in.Digits = defaultDigits
+		case len(args) == 2 && args[0] == "decimal":
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n <= 0 {
+				return fmt.Errorf("invalid number of digits %q", args[1])
+			}
+			in.Digits = n
+		default:
+			return invalid
+		}
+	case "float":
+		switch {
+		case len(args) == 1 && args[0] == "binary":
+			in.Decimal = false
+		case len(args) == 1 && args[0] == "decimal":
+			in.Decimal = true
+		default:
+			return invalid
+		}
+	case "precision":
+		if len(args) != 1 {
+			return invalid
+		}
+		n, err := strconv.ParseUint(args[0], 10, 32)
+		if err != nil || n == 0 {
+			return fmt.Errorf("invalid precision %q", args[0])
+		}
+		in.Precision = uint(n)
+	case "rounding":
+		if len(args) != 1 {
+			return invalid
+		}
+		mode, ok := roundingModes[args[0]]
+		if !ok {
+			return fmt.Errorf("unknown rounding mode %q", args[0])
+		}
+		in.Rounding = mode
+	default:
+		return fmt.Errorf("unknown option %s", name)
+	}
+	return nil
+}
+
+// directivePrefix starts the line comments that set options.
+const directivePrefix = "//calc:"
+
+// Directives sets the options given by the directives of f. A directive
+// is a line comment starting with //calc: followed by an option and its
+// arguments, as in
+//
+//	//calc:mode rational
+//
+// Directives apply to the whole file, wherever they appear in it. An
+// invalid directive is reported as an *Error at its comment.
+func (in *Interpreter) Directives(f *ast.File) error {
+	for _, g := range f.Comments {
+		for _, c := range g.List {
+			if !strings.HasPrefix(c.Text, directivePrefix) {
+				continue
+			}
+			fields := strings.Fields(c.Text[len(directivePrefix):])
+			if len(fields) == 0 {
+				return &Error{c.Pos(), "missing option in directive"}
+			}
+			if err := in.SetOption(fields[0], fields[1:]...); err != nil {
+				return &Error{c.Pos(), err.Error()}
+			}
+		}
+	}
+	return nil
+}
+
+// Format returns the string form of v, in which rational numbers are
+// printed as selected by in.Digits.
+func (in *Interpreter) Format(v Value) string {
+	switch v := v.(type) {
+	case Rat:
+		if in.Digits > 0 {
+			return decimalString(v.x, in.Digits)
+		}
+	case Tuple:
+		elts := make([]string, len(v))
+		for i, x := range v {
+			elts[i] = in.Format(x)
+		}
+		return "(" + strings.Join(elts, ", ") + ")"
+	}
+	return v.String()
+}
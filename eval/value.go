@@ -0,0 +1,186 @@
+package eval
+
+import (
+	"github.com/jonfk/calc/ast"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// A Value is the result of evaluating an expression.
+type Value interface {
+	Kind() Kind
+	String() string
+}
+
+// Kind describes the runtime type of a Value.
+type Kind int
+
+// The list of possible Value kinds.
+const (
+	Invalid Kind = iota
+	IntKind
+	RatKind
+	FloatKind
+	ComplexKind
+	BoolKind
+	StringKind
+	CharKind
+	FuncKind
+	TupleKind
+)
+
+var kindStrings = [...]string{
+	Invalid:     "invalid",
+	IntKind:     "int",
+	RatKind:     "rat",
+	FloatKind:   "float",
+	ComplexKind: "complex",
+	BoolKind:    "bool",
+	StringKind:  "string",
+	CharKind:    "char",
+	FuncKind:    "func",
+	TupleKind:   "tuple",
+}
+
+func (k Kind) String() string { return kindStrings[k] }
+
+type (
+	// An Int is a 64-bit signed integer value.
+	Int int64
+
+	// A BigInt is an integer value that does not fit in an Int.
+	// Operations on Ints whose result overflows return a BigInt,
+	// and operations on BigInts return an Int when the result fits
+	// in one, so an integer always has a single representation.
+	BigInt struct{ x *big.Int }
+
+	// A Rat is an exact rational number that is not an integer, such
+	// as the quotient 1/3 of two ints in rational mode. Operations
+	// on Rats whose result is an integer return an Int or a BigInt.
+	Rat struct{ x *big.Rat }
+
+	// A Float is a 64-bit floating point value.
+	Float float64
+
+	// A Complex is a complex number with 64-bit floating point real
+	// and imaginary parts, in decimal mode too.
+	Complex complex128
+
+	// A Bool is a boolean value.
+	Bool bool
+
+	// A String is a string value.
+	String string
+
+	// A Char is a Unicode code point.
+	Char rune
+
+	// A Tuple is a fixed-length sequence of values.
+	Tuple []Value
+
+	// A Builtin is a function provided by the interpreter.
+	// Fn reports errors by calling errorf.
+	Builtin struct {
+		Name    string
+		NumArgs int
+		Fn      func(x *ast.CallExpr, args []Value) Value
+	}
+
+	// A Func is a function value. It closes over the environment
+	// in which it was created.
+	Func struct {
+		Name   string // function name; or "" for function literals
+		Params []string
+		Types  []ast.Expr // annotated parameter types; nil elements for none
+		Result ast.Expr   // annotated result type; or nil
+		Body   *ast.BlockExpr
+		Env    *Env
+	}
+)
+
+func (Int) Kind() Kind      { return IntKind }
+func (BigInt) Kind() Kind   { return IntKind }
+func (Rat) Kind() Kind      { return RatKind }
+func (Float) Kind() Kind    { return FloatKind }
+func (Complex) Kind() Kind  { return ComplexKind }
+func (Bool) Kind() Kind     { return BoolKind }
+func (String) Kind() Kind   { return StringKind }
+func (Char) Kind() Kind     { return CharKind }
+func (*Func) Kind() Kind    { return FuncKind }
+func (Tuple) Kind() Kind    { return TupleKind }
+func (*Builtin) Kind() Kind { return FuncKind }
+
+func (v Int) String() string    { return strconv.FormatInt(int64(v), 10) }
+func (v BigInt) String() string { return v.x.String() }
+
+// String formats a rational number as a fraction such as -1/3.
+func (v Rat) String() string { return v.x.String() }
+
+// newInt returns the integer x as an Int if it fits in one and as a
+// BigInt otherwise. The BigInt takes ownership of x.
+func newInt(x *big.Int) Value {
+	if x.IsInt64() {
+		return Int(x.Int64())
+	}
+	return BigInt{x}
+}
+
+// newRat returns the rational number x as an integer if it is one
+// and as a Rat otherwise. The Rat takes ownership of x.
+func newRat(x *big.Rat) Value {
+	if x.IsInt() {
+		return newInt(new(big.Int).Set(x.Num()))
+	}
+	return Rat{x}
+}
+
+// decimalString formats x as a decimal number rounded to digits
+// places after the point, without trailing zeros.
+func decimalString(x *big.Rat, digits int) string {
+	s := x.FloatString(digits)
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(s, "0")
+		s = strings.TrimSuffix(s, ".")
+	}
+	if s == "-0" {
+		s = "0"
+	}
+	return s
+}
+
+// String formats a float so that it cannot be mistaken for an int.
+func (v Float) String() string {
+	s := strconv.FormatFloat(float64(v), 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
+
+// String formats a complex number as an expression such as (1+2i).
+func (v Complex) String() string {
+	return strconv.FormatComplex(complex128(v), 'g', -1, 128)
+}
+
+func (v Bool) String() string   { return strconv.FormatBool(bool(v)) }
+func (v String) String() string { return strconv.Quote(string(v)) }
+func (v Char) String() string   { return strconv.QuoteRune(rune(v)) }
+
+func (v Tuple) String() string {
+	elts := make([]string, len(v))
+	for i, x := range v {
+		elts[i] = x.String()
+	}
+	return "(" + strings.Join(elts, ", ") + ")"
+}
+
+func (v *Builtin) String() string { return "builtin " + v.Name }
+
+func (v *Func) String() string {
+	params := "(" + strings.Join(v.Params, ", ") + ")"
+	if v.Name == "" {
+		return "fn" + params
+	}
+	return "def " + v.Name + params
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/jonfk/calc/printer"
+	"io/ioutil"
+	"os"
+	"os/exec"
+)
+
+const fmtUsage = `usage: calc fmt [-w] [-d] file...
+
+Fmt formats calc source files. By default the formatted source is
+printed to standard output.
+
+Flags:
+  -w   write the result to the file instead of standard output
+  -d   print a diff of the changes instead of the formatted source
+`
+
+// fmtMain runs the fmt command with the arguments following its name
+// and returns the exit status of the program.
+func fmtMain(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, fmtUsage) }
+	write := flags.Bool("w", false, "write the result to the file")
+	diff := flags.Bool("d", false, "print a diff of the changes")
+	if err := flags.Parse(args); err != nil || flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	status := 0
+	for _, name := range flags.Args() {
+		if name == "-" && *write {
+			fmt.Fprintln(os.Stderr, "calc fmt: cannot use -w with standard input")
+			status = 2
+			continue
+		}
+		if err := formatFile(name, *write, *diff); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+		}
+	}
+	return status
+}
+
+// formatFile formats the named file and writes, diffs or prints the result.
+func formatFile(name string, write, diff bool) error {
+	input, err := readInput(name)
+	if err != nil {
+		return err
+	}
+	displayName := name
+	if name == "-" {
+		displayName = "<stdin>"
+	}
+	file, ok := parseInput(displayName, input)
+	if !ok {
+		return fmt.Errorf("calc fmt: %s has syntax errors", displayName)
+	}
+	res, err := printer.Source(fset, file)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(res, []byte(input)) && (write || diff) {
+		return nil
+	}
+	if diff {
+		d, err := diffSource(displayName, []byte(input), res)
+		if err != nil {
+			return fmt.Errorf("calc fmt: computing diff: %s", err)
+		}
+		fmt.Printf("diff -u %s %s\n", displayName+".orig", displayName)
+		os.Stdout.Write(d)
+	}
+	if write {
+		info, err := os.Stat(name)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(name, res, info.Mode().Perm())
+	}
+	if !diff {
+		os.Stdout.Write(res)
+	}
+	return nil
+}
+
+// diffSource returns the unified diff of b1 and b2, as printed by the
+// diff command, which like gofmt -d it relies on. The headers name
+// the original as name.orig and the result as name, so that the diff
+// can be applied with patch.
+func diffSource(name string, b1, b2 []byte) ([]byte, error) {
+	f1, err := writeTempFile("calc-fmt", b1)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f1)
+	f2, err := writeTempFile("calc-fmt", b2)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f2)
+
+	data, err := exec.Command("diff", "-u", "--label", name+".orig", "--label", name, f1, f2).CombinedOutput()
+	if len(data) > 0 {
+		// diff exits with a non-zero status when the files don't match.
+		// Ignore that failure as long as we get output.
+		return data, nil
+	}
+	return data, err
+}
+
+func writeTempFile(prefix string, data []byte) (string, error) {
+	file, err := ioutil.TempFile("", prefix)
+	if err != nil {
+		return "", err
+	}
+	_, err = file.Write(data)
+	if err1 := file.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
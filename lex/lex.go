@@ -11,16 +11,18 @@ import (
 type stateFn func(*Lexer) stateFn
 
 // lexer holds the state of the scanner.
+// Positions in the input are byte offsets; the tokens carry the
+// corresponding positions in file.
 type Lexer struct {
-	name       string     // the name of the input; used only for error reports
-	input      string     // the string being scanned
-	state      stateFn    // the next lexing function to enter
-	pos        Pos        // current position in the input
-	start      Pos        // start position of this item
-	width      Pos        // width of last rune read from input
-	lastPos    Pos        // position of most recent item returned by nextItem
-	items      chan Token // channel of scanned items
-	parenDepth int        // nesting depth of ( ) exprs
+	file       *File   // the file being scanned; records line starts
+	input      string  // the string being scanned
+	state      stateFn // the next lexing function to enter
+	pos        Pos     // current offset in the input
+	start      Pos     // start offset of this item
+	width      Pos     // width of last rune read from input
+	last       Token   // most recent item returned by nextItem
+	items      []Token // scanned items not yet returned by nextItem
+	parenDepth int     // nesting depth of ( ) exprs
 }
 
 // next returns the next rune in the input.
@@ -32,6 +34,9 @@ func (l *Lexer) next() rune {
 	r, w := utf8.DecodeRuneInString(l.input[l.pos:])
 	l.width = Pos(w)
 	l.pos += l.width
+	if r == '\n' {
+		l.file.AddLine(int(l.pos))
+	}
 	return r
 }
 
@@ -49,7 +54,7 @@ func (l *Lexer) backup() {
 
 // emit passes an item back to the client.
 func (l *Lexer) emit(t TokenType) {
-	l.items <- Token{t, l.start, l.input[l.start:l.pos]}
+	l.items = append(l.items, Token{t, l.file.Pos(int(l.start)), l.input[l.start:l.pos]})
 	l.start = l.pos
 }
 
@@ -74,54 +79,83 @@ func (l *Lexer) acceptRun(valid string) {
 	l.backup()
 }
 
-// lineNumber reports which line we're on, based on the position of
-// the previous item returned by nextItem. Doing it this way
-// means we don't have to worry about peek double counting.
-func (l *Lexer) lineNumber() int {
-	return 1 + strings.Count(l.input[:l.lastPos], "\n")
-}
-
-// colNumber reports which column on the current line we're on,
-// based on the position of the current rune
-func (l *Lexer) colNumber() int {
-	ln := l.lineNumber()
-	lines := strings.SplitN(l.input, "\n", ln)
-	var total int
-	for i := range lines[:ln-1] {
-		total += len(lines[i])
-	}
-	return int(l.pos) - total - (ln - 1)
-}
-
 // errorf returns an error token and terminates the scan by passing
 // back a nil pointer that will be the next state, terminating l.nextItem.
 func (l *Lexer) errorf(format string, args ...interface{}) stateFn {
-	l.items <- Token{ERROR, l.start, fmt.Sprintf(format, args...)}
+	l.items = append(l.items, Token{ERROR, l.file.Pos(int(l.start)), fmt.Sprintf(format, args...)})
 	return nil
 }
 
-// nextItem returns the next item from the input.
+// errorAt emits an error token positioned at offset pos instead of at
+// the start of the current item. The caller must terminate the scan.
+func (l *Lexer) errorAt(pos Pos, format string, args ...interface{}) {
+	l.items = append(l.items, Token{ERROR, l.file.Pos(int(pos)), fmt.Sprintf(format, args...)})
+}
+
+// NextItem returns the next item from the input. The state machine is
+// run on demand until it has emitted an item, so no goroutine is
+// involved. Once the input is exhausted or an error was found, NextItem
+// keeps returning the final EOF or ERROR item.
 func (l *Lexer) NextItem() Token {
-	token := <-l.items
-	l.lastPos = token.Pos
+	for len(l.items) == 0 {
+		if l.state == nil {
+			return l.last
+		}
+		l.state = l.state(l)
+		if l.state == nil {
+			// the scan may stop early at an error; record the
+			// remaining lines so all positions can be converted
+			l.file.SetLinesForContent(l.input)
+		}
+	}
+	token := l.items[0]
+	l.items = l.items[1:]
+	l.last = token
 	return token
 }
 
-// lex creates a new scanner for the input string.
+// Close stops the lexer. Items that were not returned yet are discarded
+// and NextItem returns EOF from then on. Since the lexer only runs inside
+// NextItem, an abandoned lexer holds no resources and Close is only
+// needed to stop consumers that read until EOF.
+func (l *Lexer) Close() {
+	l.state = nil
+	l.items = nil
+	l.last = Token{EOF, l.file.Pos(len(l.input)), ""}
+	l.file.SetLinesForContent(l.input)
+}
+
+// File returns the file of the input, which converts the positions
+// of the tokens to line and column numbers.
+func (l *Lexer) File() *File {
+	return l.file
+}
+
+// ParenDepth returns the nesting depth of parentheses left open at the
+// end of the input scanned so far. It is negative if a right paren had
+// no matching left paren. It is only meaningful after NextItem has
+// returned EOF or ERROR.
+func (l *Lexer) ParenDepth() int {
+	return l.parenDepth
+}
+
+// Lex creates a new scanner for the input string. The input is added
+// to a new FileSet under name, so the positions of the tokens are the
+// byte offsets in the input.
 func Lex(name, input string) *Lexer {
-	l := &Lexer{
-		name:  name,
-		input: input,
-		items: make(chan Token),
-	}
-	go l.run()
-	return l
+	return LexFile(NewFileSet().AddFile(name, -1, len(input)), input)
 }
 
-// run runs the state machine for the lexer.
-func (l *Lexer) run() {
-	for l.state = lexStart; l.state != nil; {
-		l.state = l.state(l)
+// LexFile creates a new scanner for the input of file, which must
+// have been added to its FileSet with the size of the input.
+func LexFile(file *File, input string) *Lexer {
+	if file.Size() != len(input) {
+		panic(fmt.Sprintf("lex: file size %d does not match input size %d", file.Size(), len(input)))
+	}
+	return &Lexer{
+		file:  file,
+		input: input,
+		state: lexStart,
 	}
 }
 
@@ -137,8 +171,13 @@ func lexStart(l *Lexer) stateFn {
 	case r == ',':
 		l.emit(COMMA)
 		return lexStart
+	case r == ':':
+		l.emit(COLON)
+		return lexStart
 	case r == '"':
 		return lexString
+	case r == '\'':
+		return lexChar
 	case r == '(':
 		l.emit(LEFTPAREN)
 		l.parenDepth++
@@ -147,7 +186,7 @@ func lexStart(l *Lexer) stateFn {
 		l.emit(RIGHTPAREN)
 		l.parenDepth--
 		if l.parenDepth < 0 {
-			return l.errorf("unexpected right paren at line %d:%d with %#U", l.lineNumber(), l.colNumber(), r)
+			return l.errorf("unexpected right paren")
 		}
 		return lexStart
 	case isSpace(r):
@@ -199,20 +238,47 @@ func lexEndOfLine(l *Lexer) stateFn {
 // hexadecimals by 0x
 // binary by 0b
 // otherwise interpreted as base 10
+// the digits of integers may be separated by underscores, as in 1_000
 // floats can use scientific notation with e such as 1.5e1 == 15
 // floats can only be base 10 to simplify arithmetic
+// an int or a float followed by i is imaginary, as in 3i or 2.5i
 //
 func lexNumber(l *Lexer) stateFn {
 	mark := l.pos
 	if !l.scanInt() {
 		l.pos = mark
 		if !l.scanFloat() {
-			return l.errorf("bad number syntax at %d:%d with %q", l.lineNumber(), l.colNumber(), l.input[l.start:l.pos])
+			// quote the whole literal, not only its valid prefix
+			for r := l.peek(); isAlphaNumeric(r) || r == '.'; r = l.peek() {
+				l.next()
+			}
+			return l.errorf("bad number syntax: %q", l.input[l.start:l.pos])
+		}
+		lit := strings.TrimSuffix(l.input[l.start:l.pos], "i")
+		if i := strings.IndexAny(lit, "eE"); i >= 0 && strings.Trim(lit[i+1:], "+-") == "" {
+			return l.errorf("exponent has no digits")
+		}
+		if strings.HasSuffix(l.input[l.start:l.pos], "i") {
+			l.emit(IMAG)
+		} else {
+			l.emit(FLOAT)
 		}
-		l.emit(FLOAT)
 		return lexStart
 	}
-	l.emit(INT)
+	lit := l.input[l.start:l.pos]
+	imag := strings.HasSuffix(lit, "i")
+	lit = strings.TrimSuffix(lit, "i")
+	if prefix, digits := splitIntPrefix(lit); strings.Trim(digits, "_") == "" {
+		return l.errorf("%s literal has no digits", baseNames[strings.ToLower(prefix)])
+	} else if i := invalidSep(digits, prefix != ""); i >= 0 {
+		l.errorAt(l.start+Pos(len(prefix)+i), "'_' must separate successive digits")
+		return nil
+	}
+	if imag {
+		l.emit(IMAG)
+	} else {
+		l.emit(INT)
+	}
 	return lexStart
 }
 
@@ -231,7 +297,8 @@ func (l *Lexer) scanInt() bool {
 			l.backup()
 		}
 	}
-	l.acceptRun(digits)
+	l.acceptRun(digits + "_")
+	l.accept("i")
 	if isAlphaNumeric(l.peek()) || l.peek() == '.' {
 		l.next()
 		return false
@@ -239,6 +306,42 @@ func (l *Lexer) scanInt() bool {
 	return true
 }
 
+// baseNames names the bases of the integer literal prefixes.
+var baseNames = map[string]string{
+	"0x": "hexadecimal",
+	"0c": "octal",
+	"0b": "binary",
+}
+
+// splitIntPrefix splits an integer literal accepted by scanInt into
+// its base prefix, which is empty for decimal literals, and its digits.
+func splitIntPrefix(lit string) (prefix, digits string) {
+	if len(lit) >= 2 && lit[0] == '0' {
+		if _, ok := baseNames[strings.ToLower(lit[:2])]; ok {
+			return lit[:2], lit[2:]
+		}
+	}
+	return "", lit
+}
+
+// invalidSep returns the index of the first underscore in digits that
+// does not separate two digits, or -1 if there is none. If prefixed is
+// set, the digits follow a base prefix and may start with an underscore.
+func invalidSep(digits string, prefixed bool) int {
+	for i := 0; i < len(digits); i++ {
+		if digits[i] != '_' {
+			continue
+		}
+		if i == 0 && prefixed {
+			continue
+		}
+		if i == 0 || digits[i-1] == '_' || i == len(digits)-1 {
+			return i
+		}
+	}
+	return -1
+}
+
 func (l *Lexer) scanFloat() bool {
 	digits := "0123456789"
 	l.acceptRun(digits)
@@ -249,6 +352,7 @@ func (l *Lexer) scanFloat() bool {
 		l.accept("+-")
 		l.acceptRun("0123456789")
 	}
+	l.accept("i")
 	if isAlphaNumeric(l.peek()) {
 		l.next()
 		return false
@@ -256,20 +360,99 @@ func (l *Lexer) scanFloat() bool {
 	return true
 }
 
+// lexString scans a quoted string. The opening quote is already consumed.
+// Escape sequences are checked but left undecoded in the token value.
 func lexString(l *Lexer) stateFn {
-Loop:
 	for {
-		switch r := l.next(); {
-		case r != '"':
-			// absorb.
-		case r == eof:
-			return l.errorf("Non-terminating string literal at %#U", r)
-		default:
+		switch r := l.next(); r {
+		case '"':
 			l.emit(STRING)
-			break Loop
+			return lexStart
+		case '\\':
+			if !l.scanEscape('"') {
+				return nil
+			}
+		case '\n', eof:
+			return l.errorf("string literal not terminated")
 		}
 	}
-	return lexStart
+}
+
+// lexChar scans a character literal. The opening quote is already consumed.
+// The literal must hold exactly one character or escape sequence.
+func lexChar(l *Lexer) stateFn {
+	n := 0
+	for {
+		switch r := l.next(); r {
+		case '\'':
+			switch {
+			case n == 0:
+				return l.errorf("empty character literal")
+			case n > 1:
+				return l.errorf("more than one character in character literal")
+			}
+			l.emit(CHAR)
+			return lexStart
+		case '\\':
+			if !l.scanEscape('\'') {
+				return nil
+			}
+		case '\n', eof:
+			return l.errorf("character literal not terminated")
+		}
+		n++
+	}
+}
+
+// scanEscape checks the escape sequence following a backslash that was
+// just consumed, in a literal delimited by quote. The sequences are the
+// ones of Go: \a \b \f \n \r \t \v \\, the quote, three octal digits,
+// \x and two, \u and four or \U and eight hexadecimal digits.
+// If the sequence is invalid, an error positioned at the offending
+// character is emitted and false is returned.
+func (l *Lexer) scanEscape(quote rune) bool {
+	backslash := l.pos - 1
+	var n int
+	var base, max uint32
+	switch r := l.next(); {
+	case r == 'a' || r == 'b' || r == 'f' || r == 'n' || r == 'r' || r == 't' || r == 'v' || r == '\\' || r == quote:
+		return true
+	case '0' <= r && r <= '7':
+		n, base, max = 3, 8, 255
+		l.backup()
+	case r == 'x':
+		n, base, max = 2, 16, 255
+	case r == 'u':
+		n, base, max = 4, 16, unicode.MaxRune
+	case r == 'U':
+		n, base, max = 8, 16, unicode.MaxRune
+	case r == eof || r == '\n':
+		l.errorAt(backslash, "escape sequence not terminated")
+		return false
+	default:
+		l.errorAt(backslash, "unknown escape sequence")
+		return false
+	}
+
+	var x uint32
+	for ; n > 0; n-- {
+		r := l.next()
+		d := uint32(digitVal(r))
+		if d >= base {
+			if r == eof || r == quote || r == '\n' {
+				l.errorAt(backslash, "escape sequence not terminated")
+			} else {
+				l.errorAt(l.pos-l.width, "illegal character %#U in escape sequence", r)
+			}
+			return false
+		}
+		x = x*base + d
+	}
+	if x > max || 0xD800 <= x && x < 0xE000 {
+		l.errorAt(backslash, "escape sequence is invalid Unicode code point")
+		return false
+	}
+	return true
 }
 
 // lexIdentifier scans an alphanumeric.
@@ -315,42 +498,47 @@ func (l *Lexer) atTerminator() bool {
 	return false
 }
 
-// lexOperator scans an special characters.
+// lexOperator scans an operator or a comment. Of a run of special
+// characters, the longest prefix that is an operator is taken, so that
+// 2*-1 is 2 * -1 and 2**3 is 2 ** 3.
 func lexOperator(l *Lexer) stateFn {
-Loop:
-	for {
-		switch r := l.next(); {
-		case r == '/' && l.peek() == '/':
-			return lexLineComment
-		case r == '/' && l.peek() == '*':
-			return lexBlockComment
-		case isSpecialSym(r):
-			// absorb.
-		default:
-			l.backup()
-			word := l.input[l.start:l.pos]
-			switch {
-			case key[word] > OPERATOR:
-				l.emit(key[word])
-			default:
-				return l.errorf("bad character %#U at %d:%d", r, l.lineNumber(), l.colNumber())
-			}
-			break Loop
+	rest := l.input[l.pos:]
+	switch {
+	case strings.HasPrefix(rest, "//"):
+		l.next()
+		return lexLineComment
+	case strings.HasPrefix(rest, "/*"):
+		l.next()
+		return lexBlockComment
+	}
+	n := 0
+	for n < len(rest) && isSpecialSym(rune(rest[n])) && !isCommentStart(rest[n:]) {
+		n++
+	}
+	for ; n > 0; n-- {
+		if typ := key[rest[:n]]; typ > OPERATOR {
+			l.pos += Pos(n)
+			l.emit(typ)
+			return lexStart
 		}
 	}
-	return lexStart
+	return l.errorf("bad character %#U", l.next())
+}
+
+func isCommentStart(s string) bool {
+	return strings.HasPrefix(s, "//") || strings.HasPrefix(s, "/*")
 }
 
 func lexLineComment(l *Lexer) stateFn {
 Loop:
 	for {
 		switch r := l.next(); {
-		case !isEndOfLine(r):
+		case r != eof && !isEndOfLine(r):
 			// absorb.
 		default:
 			l.backup()
 			if !l.atTerminator() {
-				return l.errorf("bad character %#U at %d:%d", r, l.lineNumber(), l.colNumber())
+				return l.errorf("bad character %#U", r)
 			}
 			l.emit(LINECOMMENT)
 			break Loop
@@ -364,10 +552,10 @@ Loop:
 	for {
 		// if we find '*' and the next is  '/'
 		switch r := l.next(); {
+		case r == eof:
+			return l.errorf("Non-terminating block comment")
 		case !l.atEndBlockComment():
 			// absorb.
-		case r == eof:
-			return l.errorf("Non-terminating block comment at %#U", r)
 		default:
 			// l.backup()
 			// l.next()
@@ -407,9 +595,23 @@ func isAlphaNumeric(r rune) bool {
 	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
 }
 
+// digitVal returns the value of the hexadecimal digit r, or 16 if r
+// is not a digit.
+func digitVal(r rune) int {
+	switch {
+	case '0' <= r && r <= '9':
+		return int(r - '0')
+	case 'a' <= r && r <= 'f':
+		return int(r - 'a' + 10)
+	case 'A' <= r && r <= 'F':
+		return int(r - 'A' + 10)
+	}
+	return 16 // larger than any legal digit val
+}
+
 // isSpecialSym reports whether r is a special symbol used as operators.
 func isSpecialSym(r rune) bool {
-	if strings.IndexRune("+-*/%&|=><!", r) >= 0 {
+	if strings.IndexRune("+-*/%&|^=><!", r) >= 0 {
 		return true
 	}
 	return false
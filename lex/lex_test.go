@@ -2,6 +2,8 @@ package lex
 
 import (
 	// "fmt"
+	"reflect"
+	"runtime"
 	"testing"
 )
 
@@ -86,6 +88,106 @@ func TestInts(t *testing.T) {
 	}
 }
 
+func TestIntSeparators(t *testing.T) {
+	valid := []string{"1_000", "0x_ff_ff", "0c7_7", "0b_1_0", "0_1"}
+	for _, input := range valid {
+		lexer := Lex("TestIntSeparators", input)
+		if item := lexer.NextItem(); item.Typ != INT || item.Val != input {
+			t.Errorf("%s: expected an integer literal, got %s", input, item)
+		}
+		if item := lexer.NextItem(); item.Typ != EOF {
+			t.Errorf("%s: expected EOF, got %s", input, item)
+		}
+	}
+
+	invalid := []struct {
+		input string
+		pos   Pos
+		msg   string
+	}{
+		{"0x", 0, "hexadecimal literal has no digits"},
+		{"1 + 0C", 4, "octal literal has no digits"},
+		{"0b_", 0, "binary literal has no digits"},
+		{"1__000", 2, "'_' must separate successive digits"},
+		{"1000_", 4, "'_' must separate successive digits"},
+		{"0x__1", 3, "'_' must separate successive digits"},
+		{"1e", 0, "exponent has no digits"},
+		{"2 * 1.e+", 4, "exponent has no digits"},
+		{"3E-i", 0, "exponent has no digits"},
+		{"0b102", 0, `bad number syntax: "0b102"`},
+		{"1 + 12ab", 4, `bad number syntax: "12ab"`},
+	}
+	for _, test := range invalid {
+		lexer := Lex("TestIntSeparators", test.input)
+		item := lexer.NextItem()
+		for item.Typ != EOF && item.Typ != ERROR {
+			item = lexer.NextItem()
+		}
+		if item.Typ != ERROR || item.Pos != test.pos || item.Val != test.msg {
+			t.Errorf("%s:\nExpected: error %q at %d\nGot:      %s at %d", test.input, test.msg, test.pos, item, item.Pos)
+		}
+	}
+}
+
+func TestOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []TokenType
+	}{
+		{"2**3", []TokenType{INT, POW, INT}},
+		{"2*-1", []TokenType{INT, MUL, SUB, INT}},
+		{"2***3", []TokenType{INT, POW, MUL, INT}},
+		{"x=-1", []TokenType{IDENTIFIER, ASSIGN, SUB, INT}},
+		{"a<<2>>b", []TokenType{IDENTIFIER, SHL, INT, SHR, IDENTIFIER}},
+		{"a<=b>=c", []TokenType{IDENTIFIER, LEQ, IDENTIFIER, GEQ, IDENTIFIER}},
+		{"a&b|c^d", []TokenType{IDENTIFIER, AND, IDENTIFIER, OR, IDENTIFIER, XOR, IDENTIFIER}},
+		{"a&&b||c", []TokenType{IDENTIFIER, LAND, IDENTIFIER, LOR, IDENTIFIER}},
+		{"x div y", []TokenType{IDENTIFIER, DIV, IDENTIFIER}},
+		{"1+//c", []TokenType{INT, ADD, LINECOMMENT}},
+		{"1*/*c*/2", []TokenType{INT, MUL, BLOCKCOMMENT, INT}},
+	}
+	for _, test := range tests {
+		lexer := Lex("TestOperators", test.input)
+		var output []TokenType
+		for item := lexer.NextItem(); item.Typ != EOF && item.Typ != ERROR; item = lexer.NextItem() {
+			output = append(output, item.Typ)
+		}
+		if !reflect.DeepEqual(output, test.expected) {
+			t.Errorf("%s:\nExpected: %v\nGot:      %v", test.input, test.expected, output)
+		}
+	}
+}
+
+func TestImag(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []TokenType
+	}{
+		{"3i", []TokenType{IMAG}},
+		{"2.5i", []TokenType{IMAG}},
+		{"1e3i", []TokenType{IMAG}},
+		{"0x1fi", []TokenType{IMAG}},
+		{"1_000i", []TokenType{IMAG}},
+		{"1+2i", []TokenType{INT, ADD, IMAG}},
+		{"2 * i", []TokenType{INT, MUL, IDENTIFIER}},
+		{"3in", []TokenType{ERROR}},
+		{"3ii", []TokenType{ERROR}},
+	}
+	for _, test := range tests {
+		lexer := Lex("TestImag", test.input)
+		var output []TokenType
+		for item := lexer.NextItem(); item.Typ != EOF; item = lexer.NextItem() {
+			output = append(output, item.Typ)
+			if item.Typ == ERROR {
+				break
+			}
+		}
+		if !reflect.DeepEqual(output, test.expected) {
+			t.Errorf("%s:\nExpected: %v\nGot:      %v", test.input, test.expected, output)
+		}
+	}
+}
+
 func TestFloats(t *testing.T) {
 	input :=
 		`3.1 2.0e10
@@ -307,6 +409,33 @@ false&&true`
 	}
 }
 
+func TestLineCommentAtEOF(t *testing.T) {
+	lexer := Lex("TestLineCommentAtEOF", "1 // one")
+	expected := []Token{
+		Token{Typ: INT, Pos: 0, Val: "1"},
+		Token{Typ: LINECOMMENT, Pos: 2, Val: "// one"},
+		Token{Typ: EOF, Pos: 8, Val: ""},
+	}
+	for _, exp := range expected {
+		if item := lexer.NextItem(); item != exp {
+			t.Errorf("Expected %#v, got %#v", exp, item)
+		}
+	}
+}
+
+func TestUnterminatedBlockComment(t *testing.T) {
+	for _, input := range []string{"1 /* note", "1 /* note *", "/*"} {
+		lexer := Lex("TestUnterminatedBlockComment", input)
+		item := lexer.NextItem()
+		for i := 0; i < 10 && item.Typ != EOF && item.Typ != ERROR; i++ {
+			item = lexer.NextItem()
+		}
+		if item.Typ != ERROR || item.Val != "Non-terminating block comment" {
+			t.Errorf("%q: expected a non-terminating block comment error, got %s", input, item)
+		}
+	}
+}
+
 func TestComments(t *testing.T) {
 	input := `
 //aoeu
@@ -461,3 +590,314 @@ val b = true`
 		}
 	}
 }
+
+func TestLetIn(t *testing.T) {
+	input := `let val x = 1 in x end`
+	lexer := Lex("TestLetIn", input)
+	var output []Token
+	expected := []Token{
+		Token{Typ: LET, Val: "let"},
+		Token{Typ: VAL, Val: "val"},
+		Token{Typ: IDENTIFIER, Val: "x"},
+		Token{Typ: ASSIGN, Val: "="},
+		Token{Typ: INT, Val: "1"},
+		Token{Typ: IN, Val: "in"},
+		Token{Typ: IDENTIFIER, Val: "x"},
+		Token{Typ: END, Val: "end"},
+		Token{Typ: EOF, Val: ""},
+	}
+	for {
+		item := lexer.NextItem()
+		output = append(output, item)
+		if item.Typ == EOF || item.Typ == ERROR {
+			break
+		}
+	}
+	if len(output) != len(expected) {
+		t.Fatalf("\nExpected: %+v\n Got:     %+v\n", expected, output)
+	}
+	for i, item := range output {
+		if item.Typ != expected[i].Typ || item.Val != expected[i].Val {
+			t.Errorf("\nExpected: %+v\n Got:     %+v\n", expected, output)
+		}
+	}
+}
+
+func TestFunctions(t *testing.T) {
+	input := `def f(a) = fn (b) => a end end`
+	lexer := Lex("TestFunctions", input)
+	var output []Token
+	expected := []Token{
+		Token{Typ: DEF, Val: "def"},
+		Token{Typ: IDENTIFIER, Val: "f"},
+		Token{Typ: LEFTPAREN, Val: "("},
+		Token{Typ: IDENTIFIER, Val: "a"},
+		Token{Typ: RIGHTPAREN, Val: ")"},
+		Token{Typ: ASSIGN, Val: "="},
+		Token{Typ: FN, Val: "fn"},
+		Token{Typ: LEFTPAREN, Val: "("},
+		Token{Typ: IDENTIFIER, Val: "b"},
+		Token{Typ: RIGHTPAREN, Val: ")"},
+		Token{Typ: ARROW, Val: "=>"},
+		Token{Typ: IDENTIFIER, Val: "a"},
+		Token{Typ: END, Val: "end"},
+		Token{Typ: END, Val: "end"},
+		Token{Typ: EOF, Val: ""},
+	}
+	for {
+		item := lexer.NextItem()
+		output = append(output, item)
+		if item.Typ == EOF || item.Typ == ERROR {
+			break
+		}
+	}
+	if len(output) != len(expected) {
+		t.Fatalf("\nExpected: %+v\n Got:     %+v\n", expected, output)
+	}
+	for i, item := range output {
+		if item.Typ != expected[i].Typ || item.Val != expected[i].Val {
+			t.Errorf("\nExpected: %+v\n Got:     %+v\n", expected, output)
+		}
+	}
+}
+
+func TestNextItemAfterEnd(t *testing.T) {
+	for _, test := range []struct {
+		input string
+		typ   TokenType
+	}{
+		{"1 + 2", EOF},
+		{"1 @ 2", ERROR},
+	} {
+		lexer := Lex("TestNextItemAfterEnd", test.input)
+		item := lexer.NextItem()
+		for item.Typ != EOF && item.Typ != ERROR {
+			item = lexer.NextItem()
+		}
+		if item.Typ != test.typ {
+			t.Fatalf("%q: expected the input to end with %d, got %s", test.input, test.typ, item)
+		}
+		for i := 0; i < 3; i++ {
+			if next := lexer.NextItem(); next != item {
+				t.Errorf("%q: expected %s again after the end of input, got %s", test.input, item, next)
+			}
+		}
+	}
+}
+
+func TestClose(t *testing.T) {
+	goroutines := runtime.NumGoroutine()
+	input := "val a = 1\nval b = 2"
+	for i := 0; i < 100; i++ {
+		lexer := Lex("TestClose", input)
+		if item := lexer.NextItem(); item.Typ != VAL {
+			t.Fatalf("Expected val, got %s", item)
+		}
+		if i%2 == 0 {
+			// abandon every other lexer without closing it
+			continue
+		}
+		lexer.Close()
+		if item := lexer.NextItem(); item.Typ != EOF || item.Pos != Pos(len(input)) {
+			t.Errorf("Expected EOF at %d after Close, got %s at %d", len(input), item, item.Pos)
+		}
+	}
+	if n := runtime.NumGoroutine(); n > goroutines {
+		t.Errorf("Expected no goroutines to be left running, got %d more", n-goroutines)
+	}
+}
+
+func TestStringEscapes(t *testing.T) {
+	valid := []string{
+		`"a\"b"`,
+		`"\a\b\f\n\r\t\v\\"`,
+		`"\101\x41\u00e9\U0001F600"`,
+		`"é"`,
+	}
+	for _, input := range valid {
+		lexer := Lex("TestStringEscapes", input)
+		if item := lexer.NextItem(); item.Typ != STRING || item.Val != input {
+			t.Errorf("%s: expected a string literal, got %s", input, item)
+		}
+		if item := lexer.NextItem(); item.Typ != EOF {
+			t.Errorf("%s: expected EOF, got %s", input, item)
+		}
+	}
+
+	invalid := []struct {
+		input string
+		pos   Pos
+		msg   string
+	}{
+		{`"a\qb"`, 2, "unknown escape sequence"},
+		{`"\x4g"`, 4, "illegal character U+0067 'g' in escape sequence"},
+		{`"\u12"`, 1, "escape sequence not terminated"},
+		{`"\uD800"`, 1, "escape sequence is invalid Unicode code point"},
+		{`"\400"`, 1, "escape sequence is invalid Unicode code point"},
+		{`"\'"`, 1, "unknown escape sequence"},
+		{`1 "abc`, 2, "string literal not terminated"},
+		{"\"a\nb\"", 0, "string literal not terminated"},
+	}
+	for _, test := range invalid {
+		lexer := Lex("TestStringEscapes", test.input)
+		item := lexer.NextItem()
+		for item.Typ != EOF && item.Typ != ERROR {
+			item = lexer.NextItem()
+		}
+		if item.Typ != ERROR || item.Pos != test.pos || item.Val != test.msg {
+			t.Errorf("%s:\nExpected: error %q at %d\nGot:      %s at %d", test.input, test.msg, test.pos, item, item.Pos)
+		}
+	}
+}
+
+func TestChars(t *testing.T) {
+	input := `'a' '\n' 'é' '\'' '"'`
+	expected := []Token{
+		Token{Typ: CHAR, Pos: 0, Val: `'a'`},
+		Token{Typ: CHAR, Pos: 4, Val: `'\n'`},
+		Token{Typ: CHAR, Pos: 9, Val: `'é'`},
+		Token{Typ: CHAR, Pos: 14, Val: `'\''`},
+		Token{Typ: CHAR, Pos: 19, Val: `'"'`},
+		Token{Typ: EOF, Pos: 22, Val: ""},
+	}
+	lexer := Lex("TestChars", input)
+	for _, exp := range expected {
+		if item := lexer.NextItem(); item != exp {
+			t.Errorf("Expected %#v, got %#v", exp, item)
+		}
+	}
+
+	invalid := []struct {
+		input string
+		pos   Pos
+		msg   string
+	}{
+		{`''`, 0, "empty character literal"},
+		{`'ab'`, 0, "more than one character in character literal"},
+		{`'\n\t'`, 0, "more than one character in character literal"},
+		{`1 'a`, 2, "character literal not terminated"},
+		{"'\n'", 0, "character literal not terminated"},
+		{`'\"'`, 1, "unknown escape sequence"},
+		{`'\400'`, 1, "escape sequence is invalid Unicode code point"},
+	}
+	for _, test := range invalid {
+		lexer := Lex("TestChars", test.input)
+		item := lexer.NextItem()
+		for item.Typ != EOF && item.Typ != ERROR {
+			item = lexer.NextItem()
+		}
+		if item.Typ != ERROR || item.Pos != test.pos || item.Val != test.msg {
+			t.Errorf("%s:\nExpected: error %q at %d\nGot:      %s at %d", test.input, test.msg, test.pos, item, item.Pos)
+		}
+	}
+}
+
+func TestTypeAnnotations(t *testing.T) {
+	input := "val x: float = 3\ndef f(a:int): int"
+	expected := []Token{
+		Token{Typ: VAL, Pos: 0, Val: "val"},
+		Token{Typ: IDENTIFIER, Pos: 4, Val: "x"},
+		Token{Typ: COLON, Pos: 5, Val: ":"},
+		Token{Typ: IDENTIFIER, Pos: 7, Val: "float"},
+		Token{Typ: ASSIGN, Pos: 13, Val: "="},
+		Token{Typ: INT, Pos: 15, Val: "3"},
+		Token{Typ: NEWLINE, Pos: 16, Val: "\n"},
+		Token{Typ: DEF, Pos: 17, Val: "def"},
+		Token{Typ: IDENTIFIER, Pos: 21, Val: "f"},
+		Token{Typ: LEFTPAREN, Pos: 22, Val: "("},
+		Token{Typ: IDENTIFIER, Pos: 23, Val: "a"},
+		Token{Typ: COLON, Pos: 24, Val: ":"},
+		Token{Typ: IDENTIFIER, Pos: 25, Val: "int"},
+		Token{Typ: RIGHTPAREN, Pos: 28, Val: ")"},
+		Token{Typ: COLON, Pos: 29, Val: ":"},
+		Token{Typ: IDENTIFIER, Pos: 31, Val: "int"},
+		Token{Typ: EOF, Pos: 34, Val: ""},
+	}
+	lexer := Lex("TestTypeAnnotations", input)
+	for _, exp := range expected {
+		if item := lexer.NextItem(); item != exp {
+			t.Errorf("Expected %#v, got %#v", exp, item)
+		}
+	}
+}
+
+func TestFileSet(t *testing.T) {
+	fset := NewFileSet()
+	inputs := []struct {
+		name  string
+		input string
+	}{
+		{"a", "1\n22 +\n\n  x"},
+		{"b", "(4\n)\n"},
+		{"c", "1 @\n2\n3"},
+	}
+	var files []*File
+	var toks [][]Token
+	for _, in := range inputs {
+		f := fset.AddFile(in.name, -1, len(in.input))
+		l := LexFile(f, in.input)
+		var ts []Token
+		for t := l.NextItem(); ; t = l.NextItem() {
+			ts = append(ts, t)
+			if t.Typ == EOF || t.Typ == ERROR {
+				break
+			}
+		}
+		files = append(files, f)
+		toks = append(toks, ts)
+	}
+
+	// the positions of the first file are byte offsets
+	if files[0].Base() != 0 || files[1].Base() != len(inputs[0].input)+1 {
+		t.Errorf("Unexpected bases %d and %d", files[0].Base(), files[1].Base())
+	}
+	tests := []struct {
+		tok Token
+		pos string
+	}{
+		{toks[0][0], "a:1:1"},
+		{toks[0][2], "a:2:1"},
+		{toks[0][3], "a:2:4"},
+		{toks[0][5], "a:4:3"},
+		{toks[0][6], "a:4:4"}, // EOF
+		{toks[1][0], "b:1:1"},
+		{toks[1][3], "b:2:1"},
+		{toks[2][1], "c:1:3"}, // lexing stops at the error
+	}
+	for _, test := range tests {
+		if pos := fset.Position(test.tok.Pos).String(); pos != test.pos {
+			t.Errorf("%s: expected position %s, got %s", test.tok, test.pos, pos)
+		}
+		if f := fset.File(test.tok.Pos); f == nil || f.Name() != test.pos[:1] {
+			t.Errorf("%s: expected file %s, got %v", test.tok, test.pos[:1], f)
+		}
+	}
+
+	// lines after a lexing error are recorded too
+	if n := files[2].LineCount(); n != 3 {
+		t.Errorf("Expected 3 lines in c, got %d", n)
+	}
+	if pos := fset.Position(files[2].Pos(6)).String(); pos != "c:3:1" {
+		t.Errorf("Expected c:3:1, got %s", pos)
+	}
+	if pos := fset.Position(Pos(fset.Base() + 10)); pos.IsValid() {
+		t.Errorf("Expected an invalid position, got %s", pos)
+	}
+}
+
+func TestPositionString(t *testing.T) {
+	tests := []struct {
+		pos      Position
+		expected string
+	}{
+		{Position{Filename: "f", Line: 2, Column: 3}, "f:2:3"},
+		{Position{Line: 2, Column: 3}, "2:3"},
+		{Position{Filename: "f"}, "f"},
+		{Position{}, "-"},
+	}
+	for _, test := range tests {
+		if s := test.pos.String(); s != test.expected {
+			t.Errorf("Expected %s, got %s", test.expected, s)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package lex
+
+import (
+	"fmt"
+	"sort"
+)
+
+// -----------------------------------------------------------------------------
+// Positions
+
+// Position describes a source position including the file, line and
+// column location. A Position is valid if the line number is > 0.
+type Position struct {
+	Filename string // filename, if any
+	Offset   int    // byte offset, starting at 0
+	Line     int    // line number, starting at 1
+	Column   int    // column number, starting at 1 (byte count)
+}
+
+// IsValid reports whether the position is valid.
+func (pos *Position) IsValid() bool { return pos.Line > 0 }
+
+// String returns a string in one of several forms:
+//
+//	file:line:column    valid position with file name
+//	line:column         valid position without file name
+//	file                invalid position with file name
+//	-                   invalid position without file name
+func (pos Position) String() string {
+	s := pos.Filename
+	if pos.IsValid() {
+		if s != "" {
+			s += ":"
+		}
+		s += fmt.Sprintf("%d:%d", pos.Line, pos.Column)
+	}
+	if s == "" {
+		s = "-"
+	}
+	return s
+}
+
+// -----------------------------------------------------------------------------
+// File
+
+// A File is a handle for a file belonging to a FileSet. It records the
+// offsets at which the lines of the file start, so that a Pos within the
+// file can be converted to a Position. The lexer adds the line starts
+// while scanning.
+type File struct {
+	name  string // file name as provided to AddFile
+	base  int    // Pos value range for this file is [base...base+size]
+	size  int    // file size as provided to AddFile
+	lines []int  // offsets of the first character of each line; lines[0] == 0
+}
+
+// Name returns the file name of file f as registered with AddFile.
+func (f *File) Name() string { return f.name }
+
+// Base returns the base offset of file f as registered with AddFile.
+func (f *File) Base() int { return f.base }
+
+// Size returns the size of file f as registered with AddFile.
+func (f *File) Size() int { return f.size }
+
+// LineCount returns the number of lines recorded in file f.
+func (f *File) LineCount() int { return len(f.lines) }
+
+// AddLine adds the offset of a new line start. Offsets that are not
+// larger than the last recorded line start, or not smaller than the
+// file size, are ignored, so the same line may be added repeatedly.
+func (f *File) AddLine(offset int) {
+	if offset > f.lines[len(f.lines)-1] && offset < f.size {
+		f.lines = append(f.lines, offset)
+	}
+}
+
+// SetLinesForContent records the line starts of content, which must
+// be the contents of the file.
+func (f *File) SetLinesForContent(content string) {
+	for i := 0; i < len(content); i++ {
+		if content[i] == '\n' {
+			f.AddLine(i + 1)
+		}
+	}
+}
+
+// Pos returns the Pos value for the given file offset.
+func (f *File) Pos(offset int) Pos {
+	if offset < 0 || offset > f.size {
+		panic(fmt.Sprintf("lex: invalid file offset %d (should be <= %d)", offset, f.size))
+	}
+	return Pos(f.base + offset)
+}
+
+// Offset returns the offset of p in file f. Positions outside of the
+// file are clamped to its start or end.
+func (f *File) Offset(p Pos) int {
+	offset := int(p) - f.base
+	switch {
+	case offset < 0:
+		return 0
+	case offset > f.size:
+		return f.size
+	}
+	return offset
+}
+
+// Line returns the line number of p in file f.
+func (f *File) Line(p Pos) int {
+	return f.Position(p).Line
+}
+
+// Position returns the Position value of p in file f.
+func (f *File) Position(p Pos) Position {
+	offset := f.Offset(p)
+	i := sort.Search(len(f.lines), func(i int) bool { return f.lines[i] > offset }) - 1
+	return Position{
+		Filename: f.name,
+		Offset:   offset,
+		Line:     i + 1,
+		Column:   offset - f.lines[i] + 1,
+	}
+}
+
+// -----------------------------------------------------------------------------
+// FileSet
+
+// A FileSet represents a set of source files. Each file is given a
+// range of Pos values [base, base+size] that does not overlap with the
+// other files of the set, so a Pos identifies both a file and an offset.
+//
+// Unlike go/token, the first file added to a set has base 0: the
+// positions of a single input are its byte offsets. NoPos is therefore
+// also the position of the first byte of that file.
+type FileSet struct {
+	base  int     // base offset for the next file
+	files []*File // list of files in the order added to the set
+	last  *File   // cache of last file looked up
+}
+
+// NewFileSet creates a new file set.
+func NewFileSet() *FileSet {
+	return &FileSet{}
+}
+
+// Base returns the minimum base offset that must be provided to AddFile
+// when adding the next file.
+func (s *FileSet) Base() int { return s.base }
+
+// AddFile adds a new file with a given filename, base offset, and file
+// size to the file set s and returns the file. A negative base means
+// s.Base(). The base must not be smaller than s.Base(); the next file
+// starts after base+size, leaving room for a position at the end of
+// the file.
+func (s *FileSet) AddFile(filename string, base, size int) *File {
+	if base < 0 {
+		base = s.base
+	}
+	if base < s.base || size < 0 {
+		panic(fmt.Sprintf("lex: invalid base %d (should be >= %d) or size %d", base, s.base, size))
+	}
+	f := &File{name: filename, base: base, size: size, lines: []int{0}}
+	s.base = base + size + 1
+	s.files = append(s.files, f)
+	s.last = f
+	return f
+}
+
+// File returns the file that contains the position p. If no such
+// file is found, the result is nil.
+func (s *FileSet) File(p Pos) *File {
+	if f := s.last; f != nil && f.base <= int(p) && int(p) <= f.base+f.size {
+		return f
+	}
+	i := sort.Search(len(s.files), func(i int) bool { return s.files[i].base > int(p) }) - 1
+	if i >= 0 {
+		if f := s.files[i]; int(p) <= f.base+f.size {
+			s.last = f
+			return f
+		}
+	}
+	return nil
+}
+
+// Position converts a Pos p in the file set into a Position value.
+// If p belongs to no file of the set, the result is invalid.
+func (s *FileSet) Position(p Pos) Position {
+	if f := s.File(p); f != nil {
+		return f.Position(p)
+	}
+	return Position{}
+}
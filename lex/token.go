@@ -46,13 +46,15 @@ const (
 	LINECOMMENT  // // ..... includes symbol
 	BLOCKCOMMENT // /* block comment includes surrounding symbols*/
 	LEFTPAREN    // '('
-	//NUMBER       // simple number, including imaginary
 	INT        // an int
 	FLOAT      // a float
+	IMAG       // an imaginary number: an int or a float followed by i
 	STRING     // a string literal
+	CHAR       // a character literal
 	RIGHTPAREN // ')'
 	SEMICOLON  // ';'
 	COMMA      // ','
+	COLON      // ':' before a type annotation
 	IDENTIFIER // alphanumeric identifier not starting with '.'
 	// Keywords appear after all the rest.
 	KEYWORD // used only to delimit the keywords
@@ -61,8 +63,11 @@ const (
 	IF      // if keyword
 	THEN    // then keyword
 	LET     // let keyword
+	IN      // in keyword
 	VAR     // var keyword
 	VAL     // val keyword
+	FN      // fn keyword
+	DEF     // def keyword
 
 	OPERATOR
 	// Operators and delimiters
@@ -71,6 +76,14 @@ const (
 	MUL // *
 	QUO // /
 	REM // %
+	POW // **
+	DIV // div keyword: integer division
+
+	AND // &
+	OR  // |
+	XOR // ^
+	SHL // <<
+	SHR // >>
 
 	LAND // &&
 	LOR  // ||
@@ -85,6 +98,7 @@ const (
 	GEQ // >=
 
 	ASSIGN // = not a keyword or operator since it does not yield an expression
+	ARROW  // => separates the parameters and body of a function literal
 )
 
 const eof = -1
@@ -95,19 +109,30 @@ var key = map[string]TokenType{
 	"if":   IF,
 	"then": THEN,
 	"let":  LET,
+	"in":   IN,
 	"val":  VAL,
 	"var":  VAR,
+	"fn":   FN,
+	"def":  DEF,
 	"+":    ADD,
 	"-":    SUB,
 	"*":    MUL,
 	"/":    QUO,
 	"%":    REM,
+	"**":   POW,
+	"div":  DIV,
+	"&":    AND,
+	"|":    OR,
+	"^":    XOR,
+	"<<":   SHL,
+	">>":   SHR,
 	"&&":   LAND,
 	"||":   LOR,
 	"==":   EQL,
 	"<":    LSS,
 	">":    GTR,
 	"=":    ASSIGN,
+	"=>":   ARROW,
 	"!":    NOT,
 	"!=":   NEQ,
 	"<=":   LEQ,
@@ -116,14 +141,16 @@ var key = map[string]TokenType{
 
 // A set of constants for precedence-based expression parsing.
 // Non-operators have lowest precedence, followed by operators
-// starting with precedence 1 up to unary operators. The highest
-// precedence serves as "catch-all" precedence for selector,
+// starting with precedence 1 up to unary operators. Only ** binds
+// tighter than unary operators, so that -2 ** 2 is -(2 ** 2). The
+// highest precedence serves as "catch-all" precedence for selector,
 // indexing, and other operator and delimiter tokens.
 //
 const (
 	LowestPrec  = 0 // non-operators
 	UnaryPrec   = 6
-	HighestPrec = 7
+	PowPrec     = 7
+	HighestPrec = 8
 )
 
 // Precedence returns the operator precedence of the binary
@@ -138,19 +165,27 @@ func (op Token) Precedence() int {
 		return 2
 	case EQL, NEQ, LSS, LEQ, GTR, GEQ:
 		return 3
-	case ADD, SUB:
+	case ADD, SUB, OR, XOR:
 		return 4
-	case MUL, QUO, REM:
+	case MUL, QUO, REM, DIV, AND, SHL, SHR:
 		return 5
+	case POW:
+		return PowPrec
 	}
 	return LowestPrec
 }
 
+// RightAssoc reports whether the binary operator op associates to
+// the right, as ** does: 2 ** 3 ** 2 is 2 ** (3 ** 2). The other
+// binary operators associate to the left.
+//
+func (op Token) RightAssoc() bool { return op.Typ == POW }
+
 // Predicates
 
 func (tok Token) IsLiteral() bool {
 	switch tok.Typ {
-	case INT, FLOAT, IDENTIFIER:
+	case INT, FLOAT, IMAG, IDENTIFIER:
 		return true
 	default:
 		return false
@@ -160,7 +195,7 @@ func (tok Token) IsLiteral() bool {
 // IsOperator returns true for tokens corresponding to operators and
 // delimiters; it returns false otherwise.
 //
-func (tok Token) IsOperator() bool { return tok.Typ > OPERATOR && tok.Typ != ASSIGN }
+func (tok Token) IsOperator() bool { return tok.Typ > OPERATOR && tok.Typ < ASSIGN }
 
 // IsKeyword returns true for tokens corresponding to keywords;
 // it returns false otherwise.
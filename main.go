@@ -1,56 +1,187 @@
+// Command calc runs programs written in the calc language.
+//
+// Usage:
+//
+//	calc                  start an interactive session
+//	calc run file...      evaluate files, printing the value of each expression
+//	calc tokens file...   print the tokens of files
+//	calc ast file...      print the syntax trees of files
+//	calc check file...    report syntax and type errors in files
+//	calc fmt [-w] [-d] file...
+//	                      format files, printing the result, writing it
+//	                      back to the files (-w) or printing a diff (-d)
+//	calc doc [-format text|markdown|html] file...
+//	                      print the documentation of the declarations of files
+//
+// A file named - is read from standard input.
 package main
 
 import (
-	// "github.com/jonfk/calc/lex"
-	//"io/ioutil"
+	"flag"
 	"fmt"
-	// "github.com/jonfk/calc/ast"
-	"github.com/davecgh/go-spew/spew"
+	"github.com/jonfk/calc/ast"
+	"github.com/jonfk/calc/eval"
+	"github.com/jonfk/calc/lex"
 	"github.com/jonfk/calc/parse"
+	"github.com/jonfk/calc/types"
+	"io/ioutil"
+	"os"
 )
 
+const usage = `usage: calc [command] [file...]
+
+Without a command calc starts an interactive session.
+
+Commands:
+  run      evaluate files, printing the value of each expression
+  tokens   print the tokens of files
+  ast      print the syntax trees of files
+  check    report syntax and type errors in files
+  fmt      format files; see calc fmt -h
+  doc      print the documentation of declarations; see calc doc -h
+
+A file named - is read from standard input.
+`
+
+// fset records the positions of all files read by a command.
+var fset = lex.NewFileSet()
+
+// commands maps command names to their implementations. Each one
+// returns the exit status of the program.
+var commands = map[string]func(name, input string) int{
+	"run":    runFile,
+	"tokens": printTokens,
+	"ast":    printAST,
+	"check":  checkFile,
+}
+
 func main() {
-	// input, err := ioutil.ReadFile("test_input/test2.calc")
-	// if err != nil {
-	// 	fmt.Println("Error reading file: \n %s", err)
-	// }
-	// lexer := lex.Lex("mytest", string(input))
-
-	// for {
-	// 	item := lexer.NextItem()
-	// 	fmt.Printf("%s ", item)
-	// 	if item.Typ == lex.EOF {
-	// 		fmt.Println()
-	// 		break
-	// 	}
-	// }
-
-	// var tree *ast.File = new(ast.File)
-	// expr := &ast.BasicLit{lex.Token{lex.INT, 0, "1"}}
-	// tree.List = append(tree.List, expr)
-
-	// var test ast.Expr
-	// test = expr
-
-	// switch test.(type) {
-	// case *ast.BasicLit:
-	// 	fmt.Println("basic lit")
-	// case nil:
-	// 	fmt.Println("nil")
-	// default:
-	// 	fmt.Println("unknown")
-	// }
-
-	// //fmt.Printf("%+v", tree)
-	// fmt.Println("tree")
-	// spew.Dump(test)
-
-	// Test parser
-	input :=
-		`4+4`
-	parser := parse.Parse("TestAdd", input)
-	fmt.Println("parser")
-	spew.Dump(parser)
-	fmt.Println("\ntree")
-	spew.Dump(parser.File)
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+	args := flag.Args()
+	if len(args) == 0 {
+		runREPL(os.Stdin, os.Stdout)
+		return
+	}
+
+	switch args[0] {
+	case "fmt":
+		os.Exit(fmtMain(args[1:]))
+	case "doc":
+		os.Exit(docMain(args[1:]))
+	}
+	cmd, ok := commands[args[0]]
+	if !ok || len(args) < 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	status := 0
+	for _, name := range args[1:] {
+		input, err := readInput(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+			continue
+		}
+		if name == "-" {
+			name = "<stdin>"
+		}
+		if s := cmd(name, input); s != 0 {
+			status = s
+		}
+	}
+	os.Exit(status)
+}
+
+// readInput returns the contents of the named file or of
+// standard input if name is -.
+func readInput(name string) (string, error) {
+	var b []byte
+	var err error
+	if name == "-" {
+		b, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		b, err = ioutil.ReadFile(name)
+	}
+	return string(b), err
+}
+
+// parseInput parses input, printing any syntax errors to standard error.
+func parseInput(name, input string) (*ast.File, bool) {
+	file, err := parse.ParseFile(fset, name, input)
+	if err != nil {
+		for _, e := range err.(parse.ErrorList) {
+			fmt.Fprintln(os.Stderr, e)
+		}
+		return file, false
+	}
+	return file, true
+}
+
+// checkTypes type checks file, printing any type errors to standard error.
+func checkTypes(file *ast.File) bool {
+	if err := types.New().CheckFile(file); err != nil {
+		for _, e := range err.(types.ErrorList) {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", fset.Position(e.Pos), e.Msg)
+		}
+		return false
+	}
+	return true
+}
+
+func runFile(name, input string) int {
+	file, ok := parseInput(name, input)
+	if !ok || !checkTypes(file) {
+		return 1
+	}
+	interp := eval.New()
+	if err := interp.Directives(file); err != nil {
+		e := err.(*eval.Error)
+		fmt.Fprintf(os.Stderr, "%s: %s\n", fset.Position(e.Pos), e.Msg)
+		return 1
+	}
+	for _, stmt := range file.List {
+		v, err := interp.EvalStmt(stmt)
+		if err != nil {
+			e := err.(*eval.Error)
+			fmt.Fprintf(os.Stderr, "%s: %s\n", fset.Position(e.Pos), e.Msg)
+			return 1
+		}
+		if _, ok := stmt.(*ast.ExprStmt); ok && v != nil {
+			fmt.Println(interp.Format(v))
+		}
+	}
+	return 0
+}
+
+func printTokens(name, input string) int {
+	l := lex.LexFile(fset.AddFile(name, -1, len(input)), input)
+	for {
+		t := l.NextItem()
+		pos := fset.Position(t.Pos)
+		fmt.Printf("%d:%d\t%s\n", pos.Line, pos.Column, t)
+		switch t.Typ {
+		case lex.EOF:
+			return 0
+		case lex.ERROR:
+			return 1
+		}
+	}
+}
+
+func printAST(name, input string) int {
+	file, ok := parseInput(name, input)
+	fmt.Println(ast.Sprint(file))
+	if !ok {
+		return 1
+	}
+	return 0
+}
+
+func checkFile(name, input string) int {
+	file, ok := parseInput(name, input)
+	if !ok || !checkTypes(file) {
+		return 1
+	}
+	return 0
 }
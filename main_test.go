@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestREPL(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2\n", "3\n"},
+		{"val x = 1\ndef f() = x end\nval x = 2\nf()\nx\n", "1\n2\n"},
+		{"val x = 1\ndef f() = x end\nval x = \"s\"\nf() * 2\n", "2\n"},
+		{"var y = 1\ndef g() = y end\ny = 5\ng()\n", "5\n"},
+		{"val x = 1\n:reset\nx\n", "<stdin>:1:1: undeclared name: x\n"},
+	}
+	for _, test := range tests {
+		var out bytes.Buffer
+		runREPL(strings.NewReader(test.input), &out)
+		got := strings.Replace(out.String(), prompt, "", -1)
+		got = strings.Replace(got, continuePrompt, "", -1)
+		if got != test.expected+"\n" {
+			t.Errorf("%q:\nExpected: %q\nGot:      %q", test.input, test.expected+"\n", got)
+		}
+	}
+}
+
+func TestDiffSource(t *testing.T) {
+	d, err := diffSource("f.calc", []byte("1+2\n"), []byte("1 + 2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitN(string(d), "\n", 3)
+	if len(lines) < 3 || !strings.HasPrefix(lines[0], "--- f.calc.orig") || !strings.HasPrefix(lines[1], "+++ f.calc") {
+		t.Errorf("Expected headers naming f.calc.orig and f.calc, got:\n%s", d)
+	}
+}
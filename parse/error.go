@@ -0,0 +1,68 @@
+package parse
+
+import (
+	"fmt"
+	"github.com/jonfk/calc/lex"
+	"sort"
+)
+
+// An Error describes a syntax error found while lexing or parsing.
+type Error struct {
+	Name string    // the name of the input
+	Pos  lex.Pos   // position of the offending token
+	Line int       // line number, starting at 1
+	Col  int       // column number, starting at 1 (byte count)
+	Tok  lex.Token // the offending token
+	Msg  string    // the error message
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s", e.Name, e.Line, e.Col, e.Msg)
+}
+
+// ErrorList is a list of *Errors.
+// The zero value for an ErrorList is an empty ErrorList ready to use.
+type ErrorList []*Error
+
+// Add adds an Error to an ErrorList.
+func (p *ErrorList) Add(e *Error) {
+	*p = append(*p, e)
+}
+
+// ErrorList implements the sort Interface.
+func (p ErrorList) Len() int      { return len(p) }
+func (p ErrorList) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+
+func (p ErrorList) Less(i, j int) bool {
+	e, f := p[i], p[j]
+	if e.Name != f.Name {
+		return e.Name < f.Name
+	}
+	return e.Pos < f.Pos
+}
+
+// Sort sorts an ErrorList by input name and position.
+func (p ErrorList) Sort() {
+	sort.Sort(p)
+}
+
+// An ErrorList implements the error interface.
+func (p ErrorList) Error() string {
+	switch len(p) {
+	case 0:
+		return "no errors"
+	case 1:
+		return p[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", p[0], len(p)-1)
+}
+
+// Err returns an error equivalent to this error list.
+// If the list is empty, Err returns nil.
+func (p ErrorList) Err() error {
+	if len(p) == 0 {
+		return nil
+	}
+	return p
+}
@@ -8,6 +8,10 @@ import (
 type ParenDepth struct {
 	Depth int
 	Stack []*ast.ParenExpr
+	// List is set while parsing an element of a parenthesized list
+	// such as the arguments of a call. The element may span lines and
+	// ends at a comma or at a ) without a matching paren expr.
+	List bool
 }
 
 func (p *ParenDepth) push(paren *ast.ParenExpr) {
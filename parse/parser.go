@@ -4,13 +4,11 @@ import (
 	"fmt"
 	"github.com/jonfk/calc/ast"
 	"github.com/jonfk/calc/lex"
-	"os"
-	"strings"
 )
 
 // parser holds the state of the scanner.
 type Parser struct {
-	name      string      // the name of the input; used only for error reports
+	file      *lex.File   // the file being parsed; converts positions for error reports
 	input     string      // the string being scanned
 	pos       int         // the position of token in Items; pos == -1 when Items is nil
 	Items     []lex.Token // the unreduced items received from the lexer
@@ -23,6 +21,12 @@ type Parser struct {
 	lastNode ast.Node   // last node parsed ??? currently only used by let. Is it necessary?
 
 	pDepth *ParenDepth // paren depth for parsing expressions
+
+	// comments attached to declarations
+	leadComments map[lex.Pos]*ast.CommentGroup // doc comments by position of the token they precede
+	lineComments map[lex.Pos]*ast.CommentGroup // line comments by end position of the token they follow
+
+	Errors ErrorList // errors found while parsing
 }
 
 // -----------------------------------------------------------------------------
@@ -36,6 +40,32 @@ func (p *Parser) closeScope() {
 	p.topScope = p.topScope.Outer
 }
 
+// declare inserts an object of the given kind for ident into the
+// current scope. decl is the node declaring it. Declaring a name twice
+// in the same scope is an error; an inner scope may shadow it.
+func (p *Parser) declare(ident *ast.Ident, kind ast.ObjKind, decl interface{}) {
+	obj := ast.NewObj(kind, ident.Tok.Val)
+	obj.Decl = decl
+	ident.Obj = obj
+	if alt := p.topScope.Insert(obj); alt != nil {
+		prev := p.file.Position(alt.Pos())
+		p.error(ident.Tok, fmt.Sprintf("%s redeclared in this scope (previous declaration at %d:%d)",
+			ident.Tok.Val, prev.Line, prev.Column))
+	}
+}
+
+// resolve looks up ident in the current scope and its outer scopes.
+// If it is not found ident is added to the file's unresolved identifiers.
+func (p *Parser) resolve(ident *ast.Ident) {
+	for s := p.topScope; s != nil; s = s.Outer {
+		if obj := s.Lookup(ident.Tok.Val); obj != nil {
+			ident.Obj = obj
+			return
+		}
+	}
+	p.File.Unresolved = append(p.File.Unresolved, ident)
+}
+
 // ------------------------------------------------------------------------------
 // parsing support
 
@@ -47,15 +77,11 @@ func (p *Parser) next() lex.Token {
 	}
 	p.pos += 1
 	if p.pos >= len(p.Items) {
-		p.errorf("Internal error in next(): parser.pos moving out of bounds of lexed tokens\n")
-	}
-	// Ignore comments for now
-	for p.Items[p.pos].Typ == lex.LINECOMMENT || p.Items[p.pos].Typ == lex.BLOCKCOMMENT {
-		p.pos += 1
+		p.errorf(p.lastToken, "internal error in next(): parser.pos moving out of bounds of lexed tokens")
 	}
-	// call p.errorf if lexing error
+	// report lexing errors like any other syntax error
 	if p.Items[p.pos].Typ == lex.ERROR {
-		p.errorf(p.Items[p.pos].String())
+		p.errorf(p.Items[p.pos], "%s", p.Items[p.pos].Val)
 	}
 	p.lastToken = p.Items[p.pos]
 	return p.Items[p.pos]
@@ -82,7 +108,7 @@ func (p *Parser) peek(k int) lex.Token {
 // return error if there aren't enough tokens in Items
 func (p *Parser) backup() error {
 	if p.pos <= -1 {
-		p.errorf("Internal error in backup: Cannot backup anymore pos is at start of Items\n")
+		p.errorf(p.lastToken, "internal error in backup(): cannot backup anymore, pos is at start of Items")
 	}
 	p.pos -= 1
 	// if p.pos != -1 {
@@ -116,48 +142,125 @@ func (p *Parser) expect(valid lex.TokenType) bool {
 	return false
 }
 
-// lineNumber reports which line we're on, based on the position of
-// the previous item returned by next.
-func (p *Parser) lineNumber() int {
-	item := p.Items[p.pos]
-	return 1 + strings.Count(p.input[:item.Pos], "\n")
+// bailout is used by errorf to unwind the recursive descent
+// back to the top of the parser.
+type bailout struct{}
+
+// error records an error at the offending token t.
+func (p *Parser) error(t lex.Token, msg string) {
+	pos := p.file.Position(t.Pos)
+	p.Errors.Add(&Error{
+		Name: pos.Filename,
+		Pos:  t.Pos,
+		Line: pos.Line,
+		Col:  pos.Column,
+		Tok:  t,
+		Msg:  msg,
+	})
+}
+
+// errorf records an error at the offending token t and abandons the
+// current statement or expression. See parseStmt and parseExpr.
+func (p *Parser) errorf(t lex.Token, format string, args ...interface{}) {
+	p.error(t, fmt.Sprintf(format, args...))
+	panic(bailout{})
 }
 
-// colNumber reports which column on the current line we're on,
-// based on the position of the previous item returned by next
-func (p *Parser) colNumber() int {
-	ln := p.lineNumber()
-	lines := strings.SplitN(p.input, "\n", ln)
-	var total int
-	for i := range lines[:ln-1] {
-		total += len(lines[i])
+// sync skips the tokens following a syntax error in the construct
+// starting at Items[start]. It stops at the next NEWLINE, SEMICOLON,
+// ELSE, IN, END or EOF that is not inside parentheses or a keyword
+// expression opened by the construct, or at the comma or parenthesis
+// ending an element of a list.
+// The token it stops at is consumed and returned.
+// Lexing errors found while skipping are reported.
+func (p *Parser) sync(start int) lex.Token {
+	if start > p.pos {
+		// nothing was consumed, as at the end of the input
+		start = p.pos
+	}
+	depth, blocks := 0, 0
+	for i := start; ; i++ {
+		t := p.Items[i]
+		if i > p.pos {
+			p.pos = i
+			if t.Typ == lex.ERROR {
+				p.error(t, t.Val)
+			}
+		}
+		switch {
+		case t.Typ == lex.LEFTPAREN:
+			depth++
+		case t.Typ == lex.RIGHTPAREN && depth > 0:
+			depth--
+		case isBlockStart(t):
+			blocks++
+		case t.Typ == lex.END && blocks > 0:
+			blocks--
+		case t.Typ == lex.EOF:
+			p.pos = i
+			return t
+		case isSyncToken(t) || p.atListEnd(t) || t.Typ == lex.COMMA && p.pDepth.List:
+			if i >= p.pos && depth == 0 && blocks == 0 {
+				return t
+			}
+		}
 	}
-	return int(p.pos) - total - (ln - 1)
 }
 
-// lineNumber reports which line we're on, based a lex.Pos
-func (p *Parser) lineNumberAt(pos lex.Pos) int {
-	return 1 + strings.Count(p.input[:pos], "\n")
+// isSyncToken reports whether t may end a statement or an expression
+// in a block.
+func isSyncToken(t lex.Token) bool {
+	switch t.Typ {
+	case lex.NEWLINE, lex.SEMICOLON, lex.ELSE, lex.IN, lex.END:
+		return true
+	}
+	return false
 }
 
-// errorf prints an error and terminates the scan
-func (p *Parser) errorf(format string, args ...interface{}) {
-	fmt.Printf(format, args...)
-	os.Exit(1)
+// recover is the handler that turns a bailout that was not recovered
+// by parseStmt or parseExpr into a return from Parse.
+func (p *Parser) recover() {
+	if e := recover(); e != nil {
+		if _, ok := e.(bailout); !ok {
+			panic(e)
+		}
+	}
+}
+
+// ParseFile parses the input string and returns the resulting file.
+// The input is added to fset under name, which then converts the
+// positions of the file's nodes to line and column numbers.
+// If there were syntax errors, the error is an ErrorList describing
+// them and the file contains BadStmt and BadExpr nodes in their place.
+func ParseFile(fset *lex.FileSet, name, input string) (*ast.File, error) {
+	p := ParseIn(fset, name, input)
+	return p.File, p.Errors.Err()
 }
 
 // Parse creates a new parser for the input string.
-// It uses lex to tokenize the input
+// It uses lex to tokenize the input, which is added to a new FileSet,
+// so positions are byte offsets in input.
+// Syntax errors are collected in the returned parser's Errors.
 func Parse(name, input string) *Parser {
-	l := lex.Lex(name, input)
+	return ParseIn(lex.NewFileSet(), name, input)
+}
+
+// ParseIn is like Parse but adds the input to fset, so that the
+// inputs parsed with the same set have distinct positions.
+func ParseIn(fset *lex.FileSet, name, input string) *Parser {
+	file := fset.AddFile(name, -1, len(input))
+	l := lex.LexFile(file, input)
 	p := &Parser{
-		name:     name,
+		file:     file,
 		input:    input,
 		pos:      -1,
 		Lexer:    l,
 		File:     ast.NewFile(),
 		topScope: ast.NewScope(nil),
 		pDepth:   new(ParenDepth),
+
+		leadComments: make(map[lex.Pos]*ast.CommentGroup),
+		lineComments: make(map[lex.Pos]*ast.CommentGroup),
 	}
 	p.run()
 	return p
@@ -170,43 +273,185 @@ func (p *Parser) run() {
 	// }
 
 	// lex everything
+	// comments are grouped in the file instead of kept in the items
+	// the lexer stops at the first error so end the items with an EOF
+	var (
+		group    []*ast.Comment // comments of the current group
+		trailing bool           // the group starts on the line of prev
+		prev     *lex.Token     // last token other than a newline or comment
+		lastLine int            // line on which the group ends
+	)
 	t := p.Lexer.NextItem()
-	for ; t.Typ != lex.EOF; t = p.Lexer.NextItem() {
+	for ; t.Typ != lex.EOF && t.Typ != lex.ERROR; t = p.Lexer.NextItem() {
+		switch t.Typ {
+		case lex.LINECOMMENT, lex.BLOCKCOMMENT:
+			c := &ast.Comment{Slash: t.Pos, Text: t.Val}
+			line := p.line(c.Pos())
+			// a line comment group only holds the comments on its line
+			if len(group) > 0 && (trailing && line > lastLine || line > lastLine+1) {
+				p.addCommentGroup(group, trailing, prev, nil)
+				group = nil
+			}
+			if len(group) == 0 {
+				trailing = prev != nil && line == p.line(end(*prev))
+			}
+			group = append(group, c)
+			lastLine = p.line(c.End())
+			continue
+		case lex.NEWLINE:
+			// newlines do not end comment groups
+		default:
+			if len(group) > 0 {
+				p.addCommentGroup(group, trailing, prev, &t)
+				group = nil
+			}
+			tok := t
+			prev = &tok
+		}
 		p.Items = append(p.Items, t)
 	}
+	if len(group) > 0 {
+		p.addCommentGroup(group, trailing, prev, nil)
+	}
 	p.Items = append(p.Items, t)
+	if t.Typ == lex.ERROR {
+		p.Items = append(p.Items, lex.Token{Typ: lex.EOF, Pos: p.file.Pos(len(p.input))})
+	}
 
+	p.File.Scope = p.topScope
+	defer p.recover()
 	parseFile(p)
 	return
 }
 
+// addCommentGroup adds the comment group made of list to the file's
+// comments. prev is the last token before the group and next the token
+// following it, or nil if there is none or it is on a later line.
+// A trailing group on the line of prev, if next is not on that line,
+// is the line comment of prev. Otherwise the group is the doc comment
+// of next if it ends on the line before next, or the doc comment of the
+// file if no token precedes it.
+func (p *Parser) addCommentGroup(list []*ast.Comment, trailing bool, prev, next *lex.Token) {
+	g := &ast.CommentGroup{List: list}
+	p.File.Comments = append(p.File.Comments, g)
+	endLine := p.line(g.End())
+	switch {
+	case trailing:
+		if next == nil || p.line(next.Pos) > endLine {
+			p.lineComments[end(*prev)] = g
+		}
+	case next != nil && p.line(next.Pos) == endLine+1:
+		p.leadComments[next.Pos] = g
+	case prev == nil && len(p.File.Doc.List) == 0:
+		p.File.Doc = g
+	}
+}
+
+// line returns the line number of pos.
+func (p *Parser) line(pos lex.Pos) int {
+	return p.file.Position(pos).Line
+}
+
+// end returns the position following token t.
+func end(t lex.Token) lex.Pos {
+	return lex.Pos(int(t.Pos) + len(t.Val))
+}
+
 // --------------------------------------------------------------------------------------------
 // Recursive descent parser
 // Mutually recursive functions
 
 func parseFile(p *Parser) {
+	for {
+		stmt := parseStmt(p)
+		if stmt == nil {
+			return
+		}
+		p.File.List = append(p.File.List, stmt)
+	}
+}
+
+// parseStmt parses the next statement and returns nil at the end of the input.
+// If the statement contains a syntax error that could not be confined to
+// one of its expressions, the parser synchronizes on the end of the
+// statement and a BadStmt covering the skipped tokens is returned.
+func parseStmt(p *Parser) (stmt ast.Stmt) {
+	var from lex.Token
+	start := p.pos + 1
+	scope, errors := p.topScope, len(p.Errors)
+	defer func() {
+		if e := recover(); e != nil {
+			if _, ok := e.(bailout); !ok {
+				panic(e)
+			}
+			if from == (lex.Token{}) {
+				from = p.Items[p.pos]
+			}
+			p.topScope = scope
+			p.pDepth = new(ParenDepth)
+			stmt = &ast.BadStmt{From: from, To: p.sync(start)}
+		}
+	}()
+
 	switch t := p.nextNonNewline(); {
+	case t.Typ == lex.EOF:
+		return nil
 	case t.Typ == lex.IDENTIFIER && p.peek(1).Typ == lex.ASSIGN:
+		from = t
 		p.backup()
-		assignStmt := parseAssign(p)
-		p.File.List = append(p.File.List, assignStmt)
-		parseFile(p)
-		// parse assignment
-	case t.Typ == lex.IDENTIFIER || isLiteral(t) || t.Typ == lex.LEFTPAREN || isUnaryOp(t):
+		stmt = parseAssign(p)
+	case t.Typ == lex.IDENTIFIER || isLiteral(t) || t.Typ == lex.LEFTPAREN || isUnaryOp(t) || isKeywordExprStart(t):
+		from = t
 		p.backup()
-		exprStmt := &ast.ExprStmt{X: parseStartExpr(p)}
-		p.File.List = append(p.File.List, exprStmt)
-		parseFile(p)
-	case t.Typ == lex.EOF:
-		return
+		stmt = &ast.ExprStmt{X: parseExpr(p)}
 	case t.Typ == lex.VAL || t.Typ == lex.VAR:
+		from = t
 		p.backup()
 		decl := parseVarValDecl(p)
-		declStmt := &ast.DeclStmt{Decl: decl}
-		p.File.List = append(p.File.List, declStmt)
+		stmt = &ast.DeclStmt{Decl: decl}
+	case t.Typ == lex.DEF:
+		from = t
+		p.backup()
+		stmt = &ast.DeclStmt{Decl: parseFuncDecl(p)}
 	default:
-		p.errorf("Invalid statement at line %d:%d with token '%s' in file : %s\n", p.lineNumber(), t.Pos, t.Val, p.name)
+		from = t
+		p.errorf(t, "invalid statement with token %s", t)
+	}
+
+	// a statement is terminated by a newline, a semicolon or the end of input
+	// unless an error was already reported for it
+	if t := p.Items[p.pos]; len(p.Errors) == errors && !atStmtEnd(t) {
+		p.errorf(t, "unexpected %s at end of statement", t)
+	}
+	return stmt
+}
+
+// parseExpr parses a complete expression.
+// If the expression contains a syntax error, the parser synchronizes on
+// the end of the expression and a BadExpr covering the skipped tokens
+// is returned so that parsing can continue.
+func parseExpr(p *Parser) (x ast.Expr) {
+	from, start := p.peek(1), p.pos+1
+	depth := len(p.pDepth.Stack)
+	scope := p.topScope
+	defer func() {
+		if e := recover(); e != nil {
+			if _, ok := e.(bailout); !ok {
+				panic(e)
+			}
+			p.topScope = scope
+			to := p.sync(start)
+			p.pDepth.Stack = p.pDepth.Stack[:depth]
+			p.pDepth.Depth = depth
+			x = &ast.BadExpr{From: from.Pos, To: to.Pos}
+		}
+	}()
+	x = parseStartExpr(p)
+	if len(p.pDepth.Stack) > depth {
+		t := p.Items[p.pos]
+		p.errorf(t, "unexpected %s in parenthesized expression, expecting )", t)
 	}
+	return x
 }
 
 func parseStartExpr(p *Parser) ast.Expr {
@@ -223,8 +468,10 @@ func parseStartExpr(p *Parser) ast.Expr {
 	case t.Typ == lex.LEFTPAREN:
 		paren := newParenExpr(p, t)
 		return parseParenExpr(p, paren, paren)
+	case isKeywordExprStart(t):
+		return parseKeywordExpr(p, nil, t)
 	default:
-		p.errorf("Invalid start of expression at line %d:%d with token '%s' in file : %s\n", p.lineNumber(), t.Pos, t.Val, p.name)
+		p.errorf(t, "invalid start of expression with token %s", t)
 	}
 	return nil
 }
@@ -235,16 +482,21 @@ func parseLiteralOrIdent(p *Parser, tree, last ast.Expr) ast.Expr {
 		oper := &ast.BinaryExpr{Op: t}
 		tree, _ = ast.InsertExpr(tree, oper)
 		return parseBinaryExpr(p, tree, oper)
-	case t.Typ == lex.NEWLINE && len(p.pDepth.Stack) > 0:
+	case t.Typ == lex.NEWLINE && p.inParens():
 		return parseLiteralOrIdent(p, tree, last)
-	case atTerminator(t):
+	case t.Typ == lex.COMMA && len(p.pDepth.Stack) > 0:
+		return parseTupleExpr(p, tree)
+	case atTerminator(t) || p.atListEnd(t):
 		return tree
 	case t.Typ == lex.RIGHTPAREN:
-		paren := p.pDepth.pop()
-		paren.Rparen = t
+		paren := closeParenExpr(p, t)
 		return parseParenExpr(p, tree, paren)
+	case t.Typ == lex.LEFTPAREN && isCallable(last):
+		call := parseCallExpr(p, last, t)
+		tree = replaceOperand(tree, last, call)
+		return parseLiteralOrIdent(p, tree, call)
 	default:
-		p.errorf("Invalid expression at line %d:%d with token '%s' in file : %s\n", p.lineNumber(), t.Pos, t.Val, p.name)
+		p.errorf(t, "invalid expression with token %s", t)
 	}
 	return nil
 }
@@ -273,45 +525,46 @@ func parseParenExpr(p *Parser, tree ast.Expr, last *ast.ParenExpr) ast.Expr {
 			paren := newParenExpr(p, t)
 			tree, _ = ast.InsertExpr(tree, paren)
 			return parseParenExpr(p, tree, paren)
+		case isKeywordExprStart(t):
+			return parseKeywordExpr(p, tree, t)
 		case t.Typ == lex.RIGHTPAREN:
-			paren := p.pDepth.pop()
-			paren.Rparen = t
+			paren := closeParenExpr(p, t)
 			if paren != last {
-				p.errorf("Internal error in parseLiteralOrIdent closing paren not matching current paren expr at line %d:%d with token '%s' in file : %s\n", p.lineNumber(), t.Pos, t.Val, p.name)
+				p.errorf(t, "internal error in parseParenExpr: closing paren not matching current paren expr with token %s", t)
 			}
 			return parseParenExpr(p, tree, last)
 		default:
-			p.errorf("Invalid expression at line %d:%d with token '%s' in file %s\n", p.lineNumber(), t.Pos, t.Val, p.name)
+			p.errorf(t, "invalid expression with token %s", t)
 		}
 	} else if last.Rparen.Val == ")" {
-		if last.X == nil {
-			// empty closed paren expr ()
-			// give value nil to ()
-			fmt.Printf("Warning: empty paren expression has value nil")
-		}
-		// Closed non-empty paren expr
+		// Closed paren expr. An empty one, (), has no value, which the
+		// type checker reports.
 		switch t := p.next(); {
 		case t.IsOperator():
 			binary := &ast.BinaryExpr{Op: t}
 			tree, _ = ast.InsertExpr(tree, binary)
 			return parseBinaryExpr(p, tree, binary)
 		case t.Typ == lex.LEFTPAREN:
-			p.errorf("Invalid paren expression closed expression followed by opening parenthesis at line %d:%d with token '%s' in file %s\n", p.lineNumber(), t.Pos, t.Val, p.name)
-			return nil
+			call := parseCallExpr(p, last, t)
+			tree = replaceOperand(tree, last, call)
+			return parseLiteralOrIdent(p, tree, call)
+		case t.Typ == lex.COMMA && len(p.pDepth.Stack) > 0:
+			return parseTupleExpr(p, tree)
+		case p.atListEnd(t):
+			return tree
 		case t.Typ == lex.RIGHTPAREN:
 			// close enclosing paren in case parenExpr{X:parenExpr{}}
-			paren := p.pDepth.pop()
-			paren.Rparen = t
+			paren := closeParenExpr(p, t)
 			return parseParenExpr(p, tree, paren)
-		case t.Typ == lex.NEWLINE && len(p.pDepth.Stack) > 0:
+		case t.Typ == lex.NEWLINE && p.inParens():
 			return parseParenExpr(p, tree, last)
 		case atTerminator(t):
 			return tree
 		default:
-			p.errorf("Invalid paren expression at line %d:%d with token '%s' in file : %s\n", p.lineNumber(), t.Pos, t.Val, p.name)
+			p.errorf(t, "invalid paren expression with token %s", t)
 		}
 	} else {
-		p.errorf("Internal error in parseParenExpr: at line %d:%d with token '%s' in file: %s\n", p.lineNumber(), p.lastToken.Pos, p.lastToken.Val, p.name)
+		p.errorf(p.lastToken, "internal error in parseParenExpr with token %s", p.lastToken)
 		return nil
 	}
 	return nil
@@ -336,11 +589,13 @@ func parseUnaryExpr(p *Parser, tree ast.Expr, last *ast.UnaryExpr) ast.Expr {
 			paren := newParenExpr(p, t)
 			tree, _ = ast.InsertExpr(tree, paren)
 			return parseParenExpr(p, tree, paren)
+		case isKeywordExprStart(t):
+			return parseKeywordExpr(p, tree, t)
 		default:
-			p.errorf("Invalid unary expression at line %d:%d with token '%s' in file : %s\n", p.lineNumber(), t.Pos, t, p.name)
+			p.errorf(t, "invalid unary expression with token %s", t)
 		}
 	} else {
-		p.errorf("Internal error in parseUnaryExpr at line %d in file : %s\n", p.lineNumber(), p.name)
+		p.errorf(p.lastToken, "internal error in parseUnaryExpr")
 	}
 	return nil
 }
@@ -364,52 +619,402 @@ func parseBinaryExpr(p *Parser, tree ast.Expr, last *ast.BinaryExpr) ast.Expr {
 			paren := newParenExpr(p, t)
 			tree, _ = ast.InsertExpr(tree, paren)
 			return parseParenExpr(p, tree, paren)
+		case isKeywordExprStart(t):
+			return parseKeywordExpr(p, tree, t)
 		default:
-			p.errorf("Invalid expression at line %d:%d with token '%s' in file : %s\n", p.lineNumber(), t.Pos, t.Val, p.name)
+			p.errorf(t, "invalid expression with token %s", t)
 		}
 	} else {
-		p.errorf("Internal Error: Invalid parser state in parseBinaryExpr")
+		p.errorf(p.lastToken, "internal error: invalid parser state in parseBinaryExpr")
 		return nil
 	}
 	return nil
 }
 
+// parseKeywordExpr parses an expression introduced by the keyword t,
+// such as an if expression, inserts it into tree as an operand and
+// continues parsing the rest of tree.
+func parseKeywordExpr(p *Parser, tree ast.Expr, t lex.Token) ast.Expr {
+	var x ast.Expr
+	switch t.Typ {
+	case lex.IF:
+		x = parseIfExpr(p, t)
+	case lex.LET:
+		x = parseLetExpr(p, t)
+	case lex.FN:
+		x = parseFuncLit(p, t)
+	default:
+		p.errorf(t, "internal error in parseKeywordExpr with token %s", t)
+	}
+	tree, _ = ast.InsertExpr(tree, x)
+	return parseLiteralOrIdent(p, tree, x)
+}
+
+// parseNestedExpr parses an expression nested inside a larger construct
+// such as the condition of an if expression. Parentheses enclosing the
+// construct do not affect the nested expression, so that newlines end
+// it and it cannot close them.
+func parseNestedExpr(p *Parser) ast.Expr {
+	outer := p.pDepth
+	p.pDepth = new(ParenDepth)
+	defer func() { p.pDepth = outer }()
+	return parseStartExpr(p)
+}
+
+// parseIfExpr parses an if expression whose if keyword has been consumed
+//
+//	"if" expr "then" block "else" block "end"
+func parseIfExpr(p *Parser, ifTok lex.Token) *ast.IfExpr {
+	ifExpr := &ast.IfExpr{If: ifTok}
+	ifExpr.Cond = parseNestedExpr(p)
+	if t := p.Items[p.pos]; t.Typ != lex.THEN {
+		p.errorf(t, "unexpected %s in if expression, expecting then", t)
+	}
+	ifExpr.Body = parseBlockExpr(p, lex.ELSE)
+	ifExpr.Else = parseBlockExpr(p, lex.END)
+	ifExpr.EndTok = p.Items[p.pos]
+	return ifExpr
+}
+
+// parseLetExpr parses a let expression whose let keyword has been consumed.
+// The declared names are in a new scope that ends with the expression.
+//
+//	"let" decl { ( newline | ";" ) decl } "in" block "end"
+func parseLetExpr(p *Parser, letTok lex.Token) *ast.LetExpr {
+	letExpr := &ast.LetExpr{Let: letTok}
+	outer := p.pDepth
+	defer func() { p.pDepth = outer }()
+	p.pDepth = new(ParenDepth)
+	p.openScope()
+decls:
+	for {
+		switch t := p.nextNonNewline(); {
+		case t.Typ == lex.VAL || t.Typ == lex.VAR:
+			p.backup()
+			letExpr.Decls = append(letExpr.Decls, parseVarValDecl(p))
+			switch t := p.Items[p.pos]; {
+			case t.Typ == lex.IN:
+				break decls
+			case t.Typ == lex.NEWLINE || t.Typ == lex.SEMICOLON:
+				// next declaration
+			default:
+				p.errorf(t, "unexpected %s in let expression, expecting in", t)
+			}
+		case t.Typ == lex.IN && len(letExpr.Decls) > 0:
+			break decls
+		default:
+			p.errorf(t, "unexpected %s in let expression, expecting val or var", t)
+		}
+	}
+	p.pDepth = outer
+	letExpr.Body = parseBlockExpr(p, lex.END)
+	letExpr.EndTok = p.Items[p.pos]
+	p.closeScope()
+	return letExpr
+}
+
+// parseTupleExpr turns the innermost open paren expr of tree into a
+// tuple expression once the comma following its first element has
+// been consumed, and parses the remaining elements.
+func parseTupleExpr(p *Parser, tree ast.Expr) ast.Expr {
+	paren := p.pDepth.pop()
+	tuple := &ast.TupleExpr{Lparen: paren.Lparen, Elts: []ast.Expr{paren.X}}
+	rest, rparen := parseExprList(p)
+	if len(rest) == 0 {
+		p.errorf(rparen, "unexpected %s in tuple, expecting expression", rparen)
+	}
+	tuple.Elts = append(tuple.Elts, rest...)
+	tuple.Rparen = rparen
+	tree = replaceOperand(tree, paren, tuple)
+	return parseLiteralOrIdent(p, tree, tuple)
+}
+
+// parseCallExpr parses the arguments of a call of fun whose opening
+// parenthesis lparen has been consumed.
+func parseCallExpr(p *Parser, fun ast.Expr, lparen lex.Token) *ast.CallExpr {
+	call := &ast.CallExpr{Fun: fun, Lparen: lparen}
+	call.Args, call.Rparen = parseExprList(p)
+	return call
+}
+
+// parseExprList parses a possibly empty list of comma separated
+// expressions following an opening parenthesis that has been consumed.
+// It returns the expressions and the closing parenthesis.
+func parseExprList(p *Parser) ([]ast.Expr, lex.Token) {
+	if t := p.nextNonNewline(); t.Typ == lex.RIGHTPAREN {
+		return nil, t
+	}
+	p.backup()
+	var list []ast.Expr
+	outer := p.pDepth
+	defer func() { p.pDepth = outer }()
+	for {
+		p.nextNonNewline()
+		p.backup()
+		p.pDepth = &ParenDepth{List: true}
+		list = append(list, parseExpr(p))
+		switch t := p.Items[p.pos]; {
+		case t.Typ == lex.COMMA:
+			// next element
+		case t.Typ == lex.RIGHTPAREN:
+			return list, t
+		default:
+			p.errorf(t, "unexpected %s in list, expecting , or )", t)
+		}
+	}
+}
+
+// parseParams parses the parenthesized parameters of a function and
+// declares them in the current scope.
+//
+//	"(" [ param { "," param } ] ")"
+//	param = IDENTIFIER [ ":" type ]
+func parseParams(p *Parser) *ast.FieldList {
+	params := &ast.FieldList{}
+	if t := p.next(); t.Typ != lex.LEFTPAREN {
+		p.errorf(t, "unexpected %s, expecting ( before parameters", t)
+	} else {
+		params.Opening = t
+	}
+	if t := p.nextNonNewline(); t.Typ == lex.RIGHTPAREN {
+		params.Closing = t
+		return params
+	}
+	p.backup()
+	for {
+		t := p.nextNonNewline()
+		if t.Typ != lex.IDENTIFIER {
+			p.errorf(t, "unexpected %s in parameter list, expecting name", t)
+		}
+		field := &ast.Field{Name: &ast.Ident{Tok: t}}
+		params.List = append(params.List, field)
+		p.declare(field.Name, ast.Val, field)
+		t = p.nextNonNewline()
+		if t.Typ == lex.COLON {
+			field.Type = parseType(p)
+			t = p.nextNonNewline()
+		}
+		switch {
+		case t.Typ == lex.COMMA:
+			// next parameter
+		case t.Typ == lex.RIGHTPAREN:
+			params.Closing = t
+			return params
+		default:
+			p.errorf(t, "unexpected %s in parameter list, expecting , or )", t)
+		}
+	}
+}
+
+// parseFuncLit parses a function literal whose fn keyword has been consumed.
+//
+//	"fn" params [ ":" type ] "=>" block "end"
+func parseFuncLit(p *Parser, fnTok lex.Token) *ast.FuncLit {
+	lit := &ast.FuncLit{Fn: fnTok}
+	p.openScope()
+	lit.Params = parseParams(p)
+	lit.Result = parseResult(p)
+	if t := p.next(); t.Typ != lex.ARROW {
+		p.errorf(t, "unexpected %s in function literal, expecting =>", t)
+	} else {
+		lit.Arrow = t
+	}
+	lit.Body = parseBlockExpr(p, lex.END)
+	lit.EndTok = p.Items[p.pos]
+	p.closeScope()
+	return lit
+}
+
+// parseFuncDecl parses a function declaration. The function name is
+// declared before the body is parsed so that the function may call
+// itself. Like the other statements, it consumes the token that
+// follows the declaration.
+//
+//	"def" IDENTIFIER params [ ":" type ] "=" block "end"
+func parseFuncDecl(p *Parser) *ast.FuncDecl {
+	decl := &ast.FuncDecl{Def: p.next()}
+	decl.Doc = p.leadComments[decl.Def.Pos]
+	if t := p.next(); t.Typ != lex.IDENTIFIER {
+		p.errorf(t, "unexpected %s in function declaration, expecting name", t)
+	} else {
+		decl.Name = &ast.Ident{Tok: t}
+	}
+	p.declare(decl.Name, ast.Fun, decl)
+	p.openScope()
+	decl.Params = parseParams(p)
+	decl.Result = parseResult(p)
+	if t := p.next(); t.Typ != lex.ASSIGN {
+		p.errorf(t, "unexpected %s in function declaration, expecting =", t)
+	}
+	decl.Body = parseBlockExpr(p, lex.END)
+	decl.EndTok = p.Items[p.pos]
+	p.closeScope()
+	p.next()
+	return decl
+}
+
+// parseBlockExpr parses a list of expressions separated by newlines or
+// semicolons following the keyword that was just consumed.
+// The block is closed by a token of type end, which is consumed.
+func parseBlockExpr(p *Parser, end lex.TokenType) *ast.BlockExpr {
+	open := p.Items[p.pos]
+	block := &ast.BlockExpr{StartPos: lex.Pos(int(open.Pos) + len(open.Val))}
+	for {
+		switch t := p.next(); {
+		case t.Typ == end:
+			if len(block.List) == 0 {
+				p.errorf(t, "missing expression after %s", open)
+			}
+			block.EndPos = t.Pos
+			return block
+		case t.Typ == lex.NEWLINE || t.Typ == lex.SEMICOLON:
+			// empty line or extra separator
+		case t.Typ == lex.EOF:
+			p.errorf(t, "unexpected %s in block following %s", t, open)
+		default:
+			p.backup()
+			outer := p.pDepth
+			p.pDepth = new(ParenDepth)
+			block.List = append(block.List, parseExpr(p))
+			p.pDepth = outer
+			switch t := p.Items[p.pos]; {
+			case t.Typ == end:
+				block.EndPos = t.Pos
+				return block
+			case t.Typ == lex.NEWLINE || t.Typ == lex.SEMICOLON:
+				// next expression
+			default:
+				p.errorf(t, "unexpected %s in block following %s", t, open)
+			}
+		}
+	}
+}
+
 func parseVarValDecl(p *Parser) ast.Decl {
 	gendecl := &ast.GenDecl{}
 	spec := &ast.ValueSpec{}
 	switch t := p.next(); {
 	case t.Typ == lex.VAR || t.Typ == lex.VAL:
 		gendecl.Tok = t
+		gendecl.Doc = p.leadComments[t.Pos]
 	default:
-		p.errorf("Invalid Declaration statement at line %d:%d with token '%s', in file : %s\n", p.lineNumber(), t.Pos, t.Val, p.name)
+		p.errorf(t, "invalid declaration statement with token %s", t)
 	}
 	switch t := p.next(); {
 	case t.Typ == lex.IDENTIFIER:
 		spec.Name = &ast.Ident{Tok: t}
+	case t.Typ == lex.LEFTPAREN:
+		spec.Pattern = parsePattern(p, t)
 	default:
-		p.errorf("Invalid Declaration statement at line %d:%d with token '%s', in file : %s\n", p.lineNumber(), t.Pos, t.Val, p.name)
+		p.errorf(t, "invalid declaration statement with token %s", t)
+	}
+	if p.peek(1).Typ == lex.COLON {
+		p.next()
+		spec.Type = parseType(p)
 	}
 	switch t := p.next(); {
 	case t.Typ == lex.ASSIGN:
 		// pass
 	default:
-		p.errorf("Invalid Declaration statement at line %d:%d with token '%s', in file : %s\n", p.lineNumber(), t.Pos, t.Val, p.name)
+		p.errorf(t, "invalid declaration statement with token %s", t)
 	}
-	spec.Value = parseStartExpr(p)
+	spec.Value = parseExpr(p)
+	spec.Comment = p.lineComments[spec.End()]
 	gendecl.Spec = spec
+	// declare the name after its value so that the value
+	// cannot refer to it
+	kind := ast.Val
+	if gendecl.Tok.Typ == lex.VAR {
+		kind = ast.Var
+	}
+	for _, name := range spec.Names() {
+		p.declare(name, kind, gendecl)
+	}
 	return gendecl
 }
 
+// parseResult parses the result type of a function following its
+// parameters, if there is one.
+func parseResult(p *Parser) ast.Expr {
+	if p.peek(1).Typ != lex.COLON {
+		return nil
+	}
+	p.next()
+	return parseType(p)
+}
+
+// parseType parses a type: the name of a basic type or a tuple of
+// types. Type names are not resolved, since they do not denote values.
+//
+//	type = IDENTIFIER | "(" type "," type { "," type } ")"
+func parseType(p *Parser) ast.Expr {
+	switch t := p.next(); {
+	case t.Typ == lex.IDENTIFIER:
+		return &ast.Ident{Tok: t}
+	case t.Typ == lex.LEFTPAREN:
+		tuple := &ast.TupleExpr{Lparen: t}
+		for {
+			tuple.Elts = append(tuple.Elts, parseType(p))
+			switch t := p.nextNonNewline(); {
+			case t.Typ == lex.COMMA:
+				// next element
+			case t.Typ == lex.RIGHTPAREN:
+				if len(tuple.Elts) < 2 {
+					p.errorf(t, "unexpected %s in tuple type, expecting ,", t)
+				}
+				tuple.Rparen = t
+				return tuple
+			default:
+				p.errorf(t, "unexpected %s in tuple type, expecting , or )", t)
+			}
+		}
+	default:
+		p.errorf(t, "unexpected %s, expecting type", t)
+	}
+	return nil
+}
+
+// parsePattern parses a tuple pattern whose opening parenthesis lparen
+// has been consumed.
+//
+//	pattern = "(" , pat , "," , pat , { "," , pat } , ")"
+//	pat     = IDENTIFIER | pattern
+func parsePattern(p *Parser, lparen lex.Token) *ast.TupleExpr {
+	tuple := &ast.TupleExpr{Lparen: lparen}
+	for {
+		switch t := p.nextNonNewline(); {
+		case t.Typ == lex.IDENTIFIER:
+			tuple.Elts = append(tuple.Elts, &ast.Ident{Tok: t})
+		case t.Typ == lex.LEFTPAREN:
+			tuple.Elts = append(tuple.Elts, parsePattern(p, t))
+		default:
+			p.errorf(t, "unexpected %s in tuple pattern, expecting name", t)
+		}
+		switch t := p.nextNonNewline(); {
+		case t.Typ == lex.COMMA:
+			// next element
+		case t.Typ == lex.RIGHTPAREN:
+			if len(tuple.Elts) < 2 {
+				p.errorf(t, "unexpected %s in tuple pattern, expecting ,", t)
+			}
+			tuple.Rparen = t
+			return tuple
+		default:
+			p.errorf(t, "unexpected %s in tuple pattern, expecting , or )", t)
+		}
+	}
+}
+
 func parseAssign(p *Parser) ast.Stmt {
 	lhs := parseStartExpr(p)
 	p.backup()
 	switch t := p.next(); {
 	case t.Typ == lex.ASSIGN:
 		tok := t
-		rhs := parseStartExpr(p)
+		rhs := parseExpr(p)
 		return &ast.AssignStmt{Lhs: lhs, Tok: tok, Rhs: rhs}
 	default:
-		p.errorf("Internal Error: Invalid parser state in parseAssign in line %d:%d with token '%s' in file: %s\n", p.lineNumber(), t.Pos, t.Val, p.name)
+		p.errorf(t, "internal error: invalid parser state in parseAssign with token %s", t)
 	}
 	return nil
 }
@@ -428,39 +1033,103 @@ func isUnaryOp(t lex.Token) bool {
 
 func isLiteral(t lex.Token) bool {
 	switch t.Typ {
-	case lex.BOOL, lex.INT, lex.FLOAT, lex.STRING:
+	case lex.BOOL, lex.INT, lex.FLOAT, lex.IMAG, lex.STRING, lex.CHAR:
 		return true
 	default:
 		return false
 	}
 }
 
+// inParens reports whether the expression being parsed is enclosed by
+// parentheses, so that newlines do not end it.
+func (p *Parser) inParens() bool {
+	return len(p.pDepth.Stack) > 0 || p.pDepth.List
+}
+
+// atListEnd reports whether t is the ) closing the list whose element
+// is being parsed.
+func (p *Parser) atListEnd(t lex.Token) bool {
+	return t.Typ == lex.RIGHTPAREN && p.pDepth.List && len(p.pDepth.Stack) == 0
+}
+
+// atStmtEnd reports whether t may terminate a statement.
+func atStmtEnd(t lex.Token) bool {
+	return t.Typ == lex.NEWLINE || t.Typ == lex.SEMICOLON || t.Typ == lex.EOF
+}
+
 func atTerminator(t lex.Token) bool {
-	if t.Typ == lex.NEWLINE || t.Typ == lex.SEMICOLON || t.Typ == lex.EOF || t.Typ == lex.THEN || t.Typ == lex.ASSIGN {
+	switch t.Typ {
+	case lex.NEWLINE, lex.SEMICOLON, lex.EOF, lex.THEN, lex.ASSIGN, lex.ELSE, lex.END, lex.IN, lex.COMMA:
 		return true
 	}
 	return false
 }
 
+// isKeywordExprStart reports whether t is a keyword starting an expression.
+func isKeywordExprStart(t lex.Token) bool {
+	switch t.Typ {
+	case lex.IF, lex.LET, lex.FN:
+		return true
+	}
+	return false
+}
+
+// isBlockStart reports whether t is a keyword opening a construct
+// that is closed by an end keyword.
+func isBlockStart(t lex.Token) bool {
+	return isKeywordExprStart(t) || t.Typ == lex.DEF
+}
+
+// isCallable reports whether an argument list may follow x.
+func isCallable(x ast.Expr) bool {
+	switch x.(type) {
+	case *ast.Ident, *ast.ParenExpr, *ast.CallExpr:
+		return true
+	}
+	return false
+}
+
+// replaceOperand replaces old, the last operand inserted into tree,
+// with x and returns the resulting tree.
+func replaceOperand(tree, old, x ast.Expr) ast.Expr {
+	if tree == old {
+		return x
+	}
+	switch t := tree.(type) {
+	case *ast.UnaryExpr:
+		t.X = replaceOperand(t.X, old, x)
+	case *ast.BinaryExpr:
+		t.Y = replaceOperand(t.Y, old, x)
+	case *ast.ParenExpr:
+		t.X = replaceOperand(t.X, old, x)
+	}
+	return tree
+}
+
 func newParenExpr(p *Parser, t lex.Token) *ast.ParenExpr {
 	paren := &ast.ParenExpr{Lparen: t}
 	p.pDepth.push(paren)
 	return paren
 }
 
+// closeParenExpr pops the innermost open paren expr, closing it with t.
+func closeParenExpr(p *Parser, t lex.Token) *ast.ParenExpr {
+	if len(p.pDepth.Stack) == 0 {
+		p.errorf(t, "unexpected %s without matching opening parenthesis", t)
+	}
+	paren := p.pDepth.pop()
+	paren.Rparen = t
+	return paren
+}
+
 func newIdentExpr(p *Parser, t lex.Token) *ast.Ident {
 	switch t.Typ {
 	case lex.IDENTIFIER:
 		ident := &ast.Ident{Tok: t}
-		obj := p.topScope.Lookup(t.Val)
-		if obj == nil {
-			p.File.Unresolved = append(p.File.Unresolved, ident)
-		} else {
-			ident.Obj = obj
-		}
+		p.resolve(ident)
 		return ident
 	default:
-		p.errorf("Invalid expression at %d:%d expected an identifier but found '%s' in file : %s\n", p.lineNumber(), t.Pos, t.Val, p.name)
+		p.errorf(t, "invalid expression: expected an identifier but found %s", t)
 	}
 	return nil
 }
@@ -1,10 +1,13 @@
 package parse
 
 import (
-	// "fmt"
+	"fmt"
 	// "github.com/davecgh/go-spew/spew"
 	"github.com/jonfk/calc/ast"
 	"github.com/jonfk/calc/lex"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -190,6 +193,40 @@ func TestSimpleArithmeticPrecedence(t *testing.T) {
 	}
 }
 
+func TestPowPrecedence(t *testing.T) {
+	// -2**3**2 | 1 = (-(2 ** (3 ** 2))) | 1
+	input := `-2**3**2 | 1`
+	parser := Parse("TestPowPrecedence", input)
+
+	output := parser.File
+	stmtList := []ast.Stmt{
+		&ast.ExprStmt{
+			X: &ast.BinaryExpr{
+				X: &ast.UnaryExpr{
+					Op: lex.Token{Typ: lex.SUB, Val: "-"},
+					X: &ast.BinaryExpr{
+						X:  &ast.BasicLit{Tok: lex.Token{Typ: lex.INT, Val: "2"}},
+						Op: lex.Token{Typ: lex.POW, Val: "**"},
+						Y: &ast.BinaryExpr{
+							X:  &ast.BasicLit{Tok: lex.Token{Typ: lex.INT, Val: "3"}},
+							Op: lex.Token{Typ: lex.POW, Val: "**"},
+							Y:  &ast.BasicLit{Tok: lex.Token{Typ: lex.INT, Val: "2"}},
+						},
+					},
+				},
+				Op: lex.Token{Typ: lex.OR, Val: "|"},
+				Y:  &ast.BasicLit{Tok: lex.Token{Typ: lex.INT, Val: "1"}},
+			},
+		},
+	}
+	expected := &ast.File{
+		List: stmtList,
+	}
+	if !ast.Equals(parser.File, expected) {
+		t.Errorf("\nExpected:\n%s\n\nGot:\n%s\n", expected.String(), output.String())
+	}
+}
+
 func TestMultiExpr(t *testing.T) {
 	input :=
 		`
@@ -447,6 +484,34 @@ func TestSimpleBoolExpr(t *testing.T) {
 	}
 }
 
+func TestCharLit(t *testing.T) {
+	input := `c == '\n' || c < 'é'`
+	parser := Parse("TestCharLit", input)
+
+	output := parser.File
+	stmtList := []ast.Stmt{
+		&ast.ExprStmt{X: &ast.BinaryExpr{
+			X: &ast.BinaryExpr{
+				X:  &ast.Ident{Tok: lex.Token{Typ: lex.IDENTIFIER, Val: "c"}},
+				Op: lex.Token{Typ: lex.EQL, Val: "=="},
+				Y:  &ast.BasicLit{Tok: lex.Token{Typ: lex.CHAR, Val: `'\n'`}},
+			},
+			Op: lex.Token{Typ: lex.LOR, Val: "||"},
+			Y: &ast.BinaryExpr{
+				X:  &ast.Ident{Tok: lex.Token{Typ: lex.IDENTIFIER, Val: "c"}},
+				Op: lex.Token{Typ: lex.LSS, Val: "<"},
+				Y:  &ast.BasicLit{Tok: lex.Token{Typ: lex.CHAR, Val: `'é'`}},
+			},
+		}},
+	}
+	expected := &ast.File{
+		List: stmtList,
+	}
+	if !ast.Equals(parser.File, expected) {
+		t.Errorf("\nExpected:\n%s\n\nGot:\n%s\n", expected.String(), output.String())
+	}
+}
+
 func TestMultiLineParenExpr(t *testing.T) {
 	input :=
 		`((10)
@@ -565,3 +630,716 @@ func TestSimpleDeclStmt(t *testing.T) {
 		t.Errorf("\nExpected:\n%s\n\nGot:\n%s\n", expected.String(), output.String())
 	}
 }
+
+func TestIfExpr(t *testing.T) {
+	input := `if a < 1 then
+	2
+	3 else 4 end
+1 + if b then 2 else 3 end * 4
+(if c then if d then 5 else 6 end else 7 end)`
+	parser := Parse("TestIfExpr", input)
+	if len(parser.Errors) > 0 {
+		t.Fatalf("unexpected errors: %s", parser.Errors)
+	}
+
+	ident := func(name string) *ast.Ident {
+		return &ast.Ident{Tok: lex.Token{Typ: lex.IDENTIFIER, Val: name}}
+	}
+	lit := func(val string) *ast.BasicLit {
+		return &ast.BasicLit{Tok: lex.Token{Typ: lex.INT, Val: val}}
+	}
+	block := func(list ...ast.Expr) *ast.BlockExpr {
+		return &ast.BlockExpr{List: list}
+	}
+	output := parser.File
+	stmtList := []ast.Stmt{
+		&ast.ExprStmt{X: &ast.IfExpr{
+			Cond: &ast.BinaryExpr{
+				X:  ident("a"),
+				Op: lex.Token{Typ: lex.LSS, Val: "<"},
+				Y:  lit("1"),
+			},
+			Body: block(lit("2"), lit("3")),
+			Else: block(lit("4")),
+		}},
+		&ast.ExprStmt{X: &ast.BinaryExpr{
+			X:  lit("1"),
+			Op: lex.Token{Typ: lex.ADD, Val: "+"},
+			Y: &ast.BinaryExpr{
+				X: &ast.IfExpr{
+					Cond: ident("b"),
+					Body: block(lit("2")),
+					Else: block(lit("3")),
+				},
+				Op: lex.Token{Typ: lex.MUL, Val: "*"},
+				Y:  lit("4"),
+			},
+		}},
+		&ast.ExprStmt{X: &ast.ParenExpr{
+			Lparen: lex.Token{Typ: lex.LEFTPAREN, Val: "("},
+			Rparen: lex.Token{Typ: lex.RIGHTPAREN, Val: ")"},
+			X: &ast.IfExpr{
+				Cond: ident("c"),
+				Body: block(&ast.IfExpr{
+					Cond: ident("d"),
+					Body: block(lit("5")),
+					Else: block(lit("6")),
+				}),
+				Else: block(lit("7")),
+			},
+		}},
+	}
+	expected := &ast.File{
+		List: stmtList,
+	}
+	if !ast.Equals(parser.File, expected) {
+		t.Errorf("\nExpected:\n%s\n\nGot:\n%s\n", expected.String(), output.String())
+	}
+}
+
+func TestLetExpr(t *testing.T) {
+	input := `let val a = 1; var b = a
+in
+	a + b
+end`
+	parser := Parse("TestLetExpr", input)
+	if len(parser.Errors) > 0 {
+		t.Fatalf("unexpected errors: %s", parser.Errors)
+	}
+
+	ident := func(name string) *ast.Ident {
+		return &ast.Ident{Tok: lex.Token{Typ: lex.IDENTIFIER, Val: name}}
+	}
+	output := parser.File
+	stmtList := []ast.Stmt{
+		&ast.ExprStmt{X: &ast.LetExpr{
+			Decls: []ast.Decl{
+				&ast.GenDecl{
+					Tok: lex.Token{Typ: lex.VAL, Val: "val"},
+					Spec: &ast.ValueSpec{
+						Name:  ident("a"),
+						Value: &ast.BasicLit{Tok: lex.Token{Typ: lex.INT, Val: "1"}},
+					},
+				},
+				&ast.GenDecl{
+					Tok: lex.Token{Typ: lex.VAR, Val: "var"},
+					Spec: &ast.ValueSpec{
+						Name:  ident("b"),
+						Value: ident("a"),
+					},
+				},
+			},
+			Body: &ast.BlockExpr{List: []ast.Expr{
+				&ast.BinaryExpr{
+					X:  ident("a"),
+					Op: lex.Token{Typ: lex.ADD, Val: "+"},
+					Y:  ident("b"),
+				},
+			}},
+		}},
+	}
+	expected := &ast.File{
+		List: stmtList,
+	}
+	if !ast.Equals(parser.File, expected) {
+		t.Errorf("\nExpected:\n%s\n\nGot:\n%s\n", expected.String(), output.String())
+	}
+}
+
+func TestLetScope(t *testing.T) {
+	input := `val x = 1
+let val x = x + 1 in x * y end
+x`
+	parser := Parse("TestLetScope", input)
+	if len(parser.Errors) > 0 {
+		t.Fatalf("unexpected errors: %s", parser.Errors)
+	}
+	outer := parser.File.Scope.Lookup("x")
+
+	let := parser.File.List[1].(*ast.ExprStmt).X.(*ast.LetExpr)
+	spec := let.Decls[0].(*ast.GenDecl).Spec.(*ast.ValueSpec)
+	if spec.Value.(*ast.BinaryExpr).X.(*ast.Ident).Obj != outer {
+		t.Errorf("Expected x in the let declaration to resolve to the outer x")
+	}
+	body := let.Body.List[0].(*ast.BinaryExpr)
+	if obj := body.X.(*ast.Ident).Obj; obj == nil || obj != spec.Name.Obj || obj == outer {
+		t.Errorf("Expected x in the let body to resolve to the let declaration")
+	}
+	if body.Y.(*ast.Ident).Obj != nil {
+		t.Errorf("Expected y to be unresolved")
+	}
+	if parser.File.List[2].(*ast.ExprStmt).X.(*ast.Ident).Obj != outer {
+		t.Errorf("Expected x after the let expression to resolve to the outer x")
+	}
+	if len(parser.File.Unresolved) != 1 || parser.File.Unresolved[0].Tok.Val != "y" {
+		t.Errorf("Expected unresolved [y], got %v", parser.File.Unresolved)
+	}
+}
+
+func TestFuncLitAndCall(t *testing.T) {
+	input := `val add = fn (a, b) => a + b end
+1 + add(2,
+	3) * 4
+(fn () => 1 end)()
+f(1)(2)`
+	parser := Parse("TestFuncLitAndCall", input)
+	if len(parser.Errors) > 0 {
+		t.Fatalf("unexpected errors: %s", parser.Errors)
+	}
+
+	ident := func(name string) *ast.Ident {
+		return &ast.Ident{Tok: lex.Token{Typ: lex.IDENTIFIER, Val: name}}
+	}
+	lit := func(val string) *ast.BasicLit {
+		return &ast.BasicLit{Tok: lex.Token{Typ: lex.INT, Val: val}}
+	}
+	params := func(names ...string) *ast.FieldList {
+		list := &ast.FieldList{}
+		for _, name := range names {
+			list.List = append(list.List, &ast.Field{Name: ident(name)})
+		}
+		return list
+	}
+	output := parser.File
+	stmtList := []ast.Stmt{
+		&ast.DeclStmt{
+			Decl: &ast.GenDecl{
+				Tok: lex.Token{Typ: lex.VAL, Val: "val"},
+				Spec: &ast.ValueSpec{
+					Name: ident("add"),
+					Value: &ast.FuncLit{
+						Params: params("a", "b"),
+						Body: &ast.BlockExpr{List: []ast.Expr{
+							&ast.BinaryExpr{
+								X:  ident("a"),
+								Op: lex.Token{Typ: lex.ADD, Val: "+"},
+								Y:  ident("b"),
+							},
+						}},
+					},
+				},
+			},
+		},
+		&ast.ExprStmt{X: &ast.BinaryExpr{
+			X:  lit("1"),
+			Op: lex.Token{Typ: lex.ADD, Val: "+"},
+			Y: &ast.BinaryExpr{
+				X: &ast.CallExpr{
+					Fun:  ident("add"),
+					Args: []ast.Expr{lit("2"), lit("3")},
+				},
+				Op: lex.Token{Typ: lex.MUL, Val: "*"},
+				Y:  lit("4"),
+			},
+		}},
+		&ast.ExprStmt{X: &ast.CallExpr{
+			Fun: &ast.ParenExpr{
+				Lparen: lex.Token{Typ: lex.LEFTPAREN, Val: "("},
+				Rparen: lex.Token{Typ: lex.RIGHTPAREN, Val: ")"},
+				X: &ast.FuncLit{
+					Params: params(),
+					Body:   &ast.BlockExpr{List: []ast.Expr{lit("1")}},
+				},
+			},
+		}},
+		&ast.ExprStmt{X: &ast.CallExpr{
+			Fun: &ast.CallExpr{
+				Fun:  ident("f"),
+				Args: []ast.Expr{lit("1")},
+			},
+			Args: []ast.Expr{lit("2")},
+		}},
+	}
+	expected := &ast.File{
+		List: stmtList,
+	}
+	if !ast.Equals(parser.File, expected) {
+		t.Errorf("\nExpected:\n%s\n\nGot:\n%s\n", expected.String(), output.String())
+	}
+}
+
+func TestFuncDecl(t *testing.T) {
+	input := `def fact(n) = if n <= 1 then 1 else n * fact(n - 1) end end
+n`
+	parser := Parse("TestFuncDecl", input)
+	if len(parser.Errors) > 0 {
+		t.Fatalf("unexpected errors: %s", parser.Errors)
+	}
+
+	decl := parser.File.List[0].(*ast.DeclStmt).Decl.(*ast.FuncDecl)
+	obj := parser.File.Scope.Lookup("fact")
+	if obj == nil || obj.Kind != ast.Fun || obj.Decl != decl || decl.Name.Obj != obj {
+		t.Errorf("Expected fact to be declared as a func in file scope, got %v", obj)
+	}
+	param := decl.Params.List[0].Name
+	if param.Obj == nil || param.Obj.Kind != ast.Val {
+		t.Errorf("Expected parameter n to be declared as a val")
+	}
+
+	var idents []*ast.Ident
+	ast.Inspect(decl.Body, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok {
+			idents = append(idents, id)
+		}
+		return true
+	})
+	for _, id := range idents {
+		want := param.Obj
+		if id.Tok.Val == "fact" {
+			want = obj
+		}
+		if id.Obj != want {
+			t.Errorf("Expected %s in the body to resolve to its declaration", id.Tok.Val)
+		}
+	}
+	if len(parser.File.Unresolved) != 1 || parser.File.Unresolved[0].Tok.Val != "n" {
+		t.Errorf("Expected unresolved [n], got %v", parser.File.Unresolved)
+	}
+}
+
+func TestTupleExpr(t *testing.T) {
+	input := `(1, (a, 2
+	), (3)) * b
+f((1, 2), 3)
+val (c, (d, e)) = (1, (2, 3))`
+	parser := Parse("TestTupleExpr", input)
+	if len(parser.Errors) > 0 {
+		t.Fatalf("unexpected errors: %s", parser.Errors)
+	}
+
+	ident := func(name string) *ast.Ident {
+		return &ast.Ident{Tok: lex.Token{Typ: lex.IDENTIFIER, Val: name}}
+	}
+	lit := func(val string) *ast.BasicLit {
+		return &ast.BasicLit{Tok: lex.Token{Typ: lex.INT, Val: val}}
+	}
+	tuple := func(elts ...ast.Expr) *ast.TupleExpr {
+		return &ast.TupleExpr{Elts: elts}
+	}
+	output := parser.File
+	stmtList := []ast.Stmt{
+		&ast.ExprStmt{X: &ast.BinaryExpr{
+			X: tuple(
+				lit("1"),
+				tuple(ident("a"), lit("2")),
+				&ast.ParenExpr{
+					Lparen: lex.Token{Typ: lex.LEFTPAREN, Val: "("},
+					Rparen: lex.Token{Typ: lex.RIGHTPAREN, Val: ")"},
+					X:      lit("3"),
+				},
+			),
+			Op: lex.Token{Typ: lex.MUL, Val: "*"},
+			Y:  ident("b"),
+		}},
+		&ast.ExprStmt{X: &ast.CallExpr{
+			Fun:  ident("f"),
+			Args: []ast.Expr{tuple(lit("1"), lit("2")), lit("3")},
+		}},
+		&ast.DeclStmt{
+			Decl: &ast.GenDecl{
+				Tok: lex.Token{Typ: lex.VAL, Val: "val"},
+				Spec: &ast.ValueSpec{
+					Pattern: tuple(ident("c"), tuple(ident("d"), ident("e"))),
+					Value:   tuple(lit("1"), tuple(lit("2"), lit("3"))),
+				},
+			},
+		},
+	}
+	expected := &ast.File{
+		List: stmtList,
+	}
+	if !ast.Equals(parser.File, expected) {
+		t.Errorf("\nExpected:\n%s\n\nGot:\n%s\n", expected.String(), output.String())
+	}
+
+	for _, name := range []string{"c", "d", "e"} {
+		if obj := parser.File.Scope.Lookup(name); obj == nil || obj.Kind != ast.Val {
+			t.Errorf("Expected %s to be declared as a val in file scope, got %v", name, obj)
+		}
+	}
+}
+
+func TestTypeAnnotations(t *testing.T) {
+	input := `val x: float = 1
+def f(a: int, b): (int, bool) = (a, b) end
+fn (s: string) : string => s end`
+	parser := Parse("TestTypeAnnotations", input)
+	if len(parser.Errors) > 0 {
+		t.Fatalf("unexpected errors: %s", parser.Errors)
+	}
+
+	ident := func(name string) *ast.Ident {
+		return &ast.Ident{Tok: lex.Token{Typ: lex.IDENTIFIER, Val: name}}
+	}
+	list := parser.File.List
+	spec := list[0].(*ast.DeclStmt).Decl.(*ast.GenDecl).Spec.(*ast.ValueSpec)
+	if !ast.Equals(spec.Type, ident("float")) {
+		t.Errorf("Expected val x to be annotated with float, got %v", spec.Type)
+	}
+	decl := list[1].(*ast.DeclStmt).Decl.(*ast.FuncDecl)
+	if params := decl.Params.List; !ast.Equals(params[0].Type, ident("int")) || params[1].Type != nil {
+		t.Errorf("Expected params (a: int, b), got %s", decl.Params)
+	}
+	if !ast.Equals(decl.Result, &ast.TupleExpr{Elts: []ast.Expr{ident("int"), ident("bool")}}) {
+		t.Errorf("Expected f to return (int, bool), got %v", decl.Result)
+	}
+	lit := list[2].(*ast.ExprStmt).X.(*ast.FuncLit)
+	if !ast.Equals(lit.Params.List[0].Type, ident("string")) || !ast.Equals(lit.Result, ident("string")) {
+		t.Errorf("Expected fn (s: string): string, got %s", lit.Params)
+	}
+
+	// Type names live apart from values and are left unresolved.
+	if len(parser.File.Unresolved) != 0 {
+		t.Errorf("Expected no unresolved identifiers, got %v", parser.File.Unresolved)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		line  int
+		col   int
+		tok   lex.Token
+	}{
+		{"4 +", 1, 4, lex.Token{Typ: lex.EOF, Val: ""}},
+		{"val = 3", 1, 5, lex.Token{Typ: lex.ASSIGN, Val: "="}},
+		{"4+4\n(4))", 2, 4, lex.Token{Typ: lex.RIGHTPAREN, Val: ")"}},
+		{"1\n  2 @ 3", 2, 5, lex.Token{Typ: lex.ERROR, Val: `unknown syntax: "@"`}},
+		{"1\n)", 2, 1, lex.Token{Typ: lex.RIGHTPAREN, Val: ")"}},
+		{"if true 1 else 2 end", 1, 9, lex.Token{Typ: lex.INT, Val: "1"}},
+		{"if a then else 2 end", 1, 11, lex.Token{Typ: lex.ELSE, Val: "else"}},
+		{"if a then 1 end", 1, 13, lex.Token{Typ: lex.END, Val: "end"}},
+		{"if a then 1 else 2", 1, 19, lex.Token{Typ: lex.EOF, Val: ""}},
+		{"let in 1 end", 1, 5, lex.Token{Typ: lex.IN, Val: "in"}},
+		{"let val a = 1 a end", 1, 15, lex.Token{Typ: lex.IDENTIFIER, Val: "a"}},
+		{"let val a = 1 in a", 1, 19, lex.Token{Typ: lex.EOF, Val: ""}},
+		{"fn x => x end", 1, 4, lex.Token{Typ: lex.IDENTIFIER, Val: "x"}},
+		{"fn (x) x end", 1, 8, lex.Token{Typ: lex.IDENTIFIER, Val: "x"}},
+		{"def f(1) = 1 end", 1, 7, lex.Token{Typ: lex.INT, Val: "1"}},
+		{"def f(a) 1 end", 1, 10, lex.Token{Typ: lex.INT, Val: "1"}},
+		{"f(1 2)", 1, 5, lex.Token{Typ: lex.INT, Val: "2"}},
+		{"f(1,", 1, 5, lex.Token{Typ: lex.EOF, Val: ""}},
+		{"3(4)", 1, 2, lex.Token{Typ: lex.LEFTPAREN, Val: "("}},
+		{"(1,)", 1, 4, lex.Token{Typ: lex.RIGHTPAREN, Val: ")"}},
+		{"(1, 2", 1, 6, lex.Token{Typ: lex.EOF, Val: ""}},
+		{"val (a) = 1", 1, 7, lex.Token{Typ: lex.RIGHTPAREN, Val: ")"}},
+		{"val (a, 1) = 1", 1, 9, lex.Token{Typ: lex.INT, Val: "1"}},
+		{"val (a, a) = (1, 2)", 1, 9, lex.Token{Typ: lex.IDENTIFIER, Val: "a"}},
+		{"val a = 1\nvar a = 2", 2, 5, lex.Token{Typ: lex.IDENTIFIER, Val: "a"}},
+		{"def f(a, a) = a end", 1, 10, lex.Token{Typ: lex.IDENTIFIER, Val: "a"}},
+		{"let val a = 1; val a = 2 in a end", 1, 20, lex.Token{Typ: lex.IDENTIFIER, Val: "a"}},
+		{"val x: = 1", 1, 8, lex.Token{Typ: lex.ASSIGN, Val: "="}},
+		{"def f(a: (int)) = a end", 1, 14, lex.Token{Typ: lex.RIGHTPAREN, Val: ")"}},
+		{"fn (a): => a end", 1, 9, lex.Token{Typ: lex.ARROW, Val: "=>"}},
+	}
+	for _, test := range tests {
+		file, err := ParseFile(lex.NewFileSet(), "TestParseErrors", test.input)
+		if file == nil {
+			t.Errorf("%q: expected a partial file, got nil", test.input)
+		}
+		list, ok := err.(ErrorList)
+		if !ok || len(list) == 0 {
+			t.Errorf("%q: expected an ErrorList, got %v", test.input, err)
+			continue
+		}
+		e := list[0]
+		if e.Name != "TestParseErrors" || e.Line != test.line || e.Col != test.col || !e.Tok.Equals(test.tok) {
+			t.Errorf("%q:\nExpected: TestParseErrors:%d:%d at %s\nGot:      %s at %s\n", test.input, test.line, test.col, test.tok, e, e.Tok)
+		}
+	}
+}
+
+func TestParseFileSet(t *testing.T) {
+	fset := lex.NewFileSet()
+	inputs := []struct {
+		name  string
+		input string
+		pos   string // position of the first error
+	}{
+		{"a.calc", "1 +\n2", ""},
+		{"b.calc", "val x = 1\n\n  x +", "b.calc:3:6"},
+		{"c.calc", "1\n  2 @ 3", "c.calc:2:5"},
+	}
+	var files []*ast.File
+	for _, in := range inputs {
+		file, err := ParseFile(fset, in.name, in.input)
+		files = append(files, file)
+		switch {
+		case in.pos == "" && err != nil:
+			t.Errorf("%s: unexpected error: %s", in.name, err)
+		case in.pos != "":
+			e, ok := err.(ErrorList)
+			if !ok {
+				t.Errorf("%s: expected errors, got %v", in.name, err)
+				continue
+			}
+			if pos := fmt.Sprintf("%s:%d:%d", e[0].Name, e[0].Line, e[0].Col); pos != in.pos {
+				t.Errorf("%s: expected error at %s, got %s", in.name, in.pos, pos)
+			}
+			if pos := fset.Position(e[0].Pos).String(); pos != in.pos {
+				t.Errorf("%s: expected position %s, got %s", in.name, in.pos, pos)
+			}
+		}
+	}
+
+	// the declaration of x is in the second file
+	decl := files[1].List[0].(*ast.DeclStmt).Decl
+	if pos := fset.Position(decl.Pos()).String(); pos != "b.calc:1:1" {
+		t.Errorf("Expected declaration at b.calc:1:1, got %s", pos)
+	}
+	bin := files[0].List[0].(*ast.ExprStmt).X
+	if pos := fset.Position(bin.End()).String(); pos != "a.calc:2:2" {
+		t.Errorf("Expected expression to end at a.calc:2:2, got %s", pos)
+	}
+}
+
+func TestParseErrorRecovery(t *testing.T) {
+	input := `4 + * 2
+val = 3
+5;6 7
+var x = (1 +
+  2 +)
+9
+* 10
+8`
+	parser := Parse("TestParseErrorRecovery", input)
+
+	output := parser.File
+	stmtList := []ast.Stmt{
+		&ast.ExprStmt{X: &ast.BadExpr{}},
+		&ast.BadStmt{},
+		&ast.ExprStmt{X: &ast.BasicLit{Tok: lex.Token{Typ: lex.INT, Val: "5"}}},
+		&ast.ExprStmt{X: &ast.BadExpr{}},
+		&ast.DeclStmt{
+			Decl: &ast.GenDecl{
+				Tok: lex.Token{Typ: lex.VAR, Val: "var"},
+				Spec: &ast.ValueSpec{
+					Name:  &ast.Ident{Tok: lex.Token{Typ: lex.IDENTIFIER, Val: "x"}},
+					Value: &ast.BadExpr{},
+				},
+			},
+		},
+		&ast.ExprStmt{X: &ast.BasicLit{Tok: lex.Token{Typ: lex.INT, Val: "9"}}},
+		&ast.BadStmt{},
+		&ast.ExprStmt{X: &ast.BasicLit{Tok: lex.Token{Typ: lex.INT, Val: "8"}}},
+	}
+	expected := &ast.File{
+		List: stmtList,
+	}
+	if !ast.Equals(parser.File, expected) {
+		t.Errorf("\nExpected:\n%s\n\nGot:\n%s\n", expected.String(), output.String())
+	}
+
+	lines := []int{1, 2, 3, 5, 7}
+	if len(parser.Errors) != len(lines) {
+		t.Fatalf("Expected %d errors, got %d: %v", len(lines), len(parser.Errors), parser.Errors)
+	}
+	for i, e := range parser.Errors {
+		if e.Line != lines[i] {
+			t.Errorf("Expected error %d on line %d, got %s", i, lines[i], e)
+		}
+	}
+
+	bad := output.List[0].(*ast.ExprStmt).X.(*ast.BadExpr)
+	if bad.From != 0 || bad.To != lex.Pos(len("4 + * 2")) {
+		t.Errorf("Expected BadExpr to cover 0-%d, got %d-%d", len("4 + * 2"), bad.From, bad.To)
+	}
+}
+
+func TestResolveDecls(t *testing.T) {
+	input := `val a = 1
+var b = a + c
+b = b * a
+d = 2`
+	parser := Parse("TestResolveDecls", input)
+
+	var unresolved []string
+	for _, ident := range parser.File.Unresolved {
+		unresolved = append(unresolved, ident.Tok.Val)
+	}
+	if len(unresolved) != 2 || unresolved[0] != "c" || unresolved[1] != "d" {
+		t.Errorf("Expected unresolved [c d], got %v", unresolved)
+	}
+
+	for name, kind := range map[string]ast.ObjKind{"a": ast.Val, "b": ast.Var} {
+		obj := parser.File.Scope.Lookup(name)
+		if obj == nil || obj.Kind != kind {
+			t.Errorf("Expected %s to be declared as %s in file scope, got %v", name, kind, obj)
+		}
+	}
+
+	assign := parser.File.List[2].(*ast.AssignStmt)
+	if assign.Lhs.(*ast.Ident).Obj != parser.File.Scope.Lookup("b") {
+		t.Errorf("Expected b to resolve to its declaration")
+	}
+}
+
+func TestRedeclaration(t *testing.T) {
+	input := `val a = 1
+def f(a) = let val a = a in a end end
+val (b, (c, a)) = (1, (2, 3))`
+	parser := Parse("TestRedeclaration", input)
+	if len(parser.Errors) != 1 {
+		t.Fatalf("Expected 1 error, got %v", parser.Errors)
+	}
+	want := "TestRedeclaration:3:13: a redeclared in this scope (previous declaration at 1:5)"
+	if got := parser.Errors[0].Error(); got != want {
+		t.Errorf("\nExpected: %s\nGot:      %s", want, got)
+	}
+}
+
+func TestInspectTestInput(t *testing.T) {
+	names, err := filepath.Glob(filepath.Join("..", "test_input", "*.calc"))
+	if err != nil || len(names) == 0 {
+		t.Fatalf("no test input found: %v", err)
+	}
+	for _, name := range names {
+		input, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parser := Parse(name, string(input))
+		stmts := 0
+		ast.Inspect(parser.File, func(n ast.Node) bool {
+			if _, ok := n.(ast.Stmt); ok {
+				stmts++
+			}
+			return true
+		})
+		if stmts != len(parser.File.List) {
+			t.Errorf("%s: expected %d statements, inspected %d", name, len(parser.File.List), stmts)
+		}
+	}
+}
+
+// TestTestInput checks that the test input has no syntax errors.
+func TestTestInput(t *testing.T) {
+	names, err := filepath.Glob(filepath.Join("..", "test_input", "*.calc"))
+	if err != nil || len(names) == 0 {
+		t.Fatalf("no test input found: %v", err)
+	}
+	for _, name := range names {
+		input, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parser := Parse(name, string(input))
+		for _, e := range parser.Errors {
+			t.Errorf("%s", e)
+		}
+	}
+}
+
+func TestInspectAllNodes(t *testing.T) {
+	input := `val (a, b) = (1, 2)
+var c = -a
+c = c + 1
+def f(x) = if x > 0 then f(x - 1) else 0 end end
+let val g = fn (y) => (y) end in g(b) end
+if true then 1 end
+val = 3
+4 +`
+	parser := Parse("TestInspectAllNodes", input)
+
+	seen := make(map[string]bool)
+	ast.Inspect(parser.File, func(n ast.Node) bool {
+		if n != nil {
+			seen[fmt.Sprintf("%T", n)] = true
+		}
+		return true
+	})
+	for _, typ := range []string{
+		"*ast.File", "*ast.DeclStmt", "*ast.ExprStmt", "*ast.AssignStmt", "*ast.BadStmt", "*ast.BadExpr",
+		"*ast.GenDecl", "*ast.FuncDecl", "*ast.ValueSpec", "*ast.Field", "*ast.FieldList",
+		"*ast.Ident", "*ast.BasicLit", "*ast.ParenExpr", "*ast.TupleExpr", "*ast.UnaryExpr",
+		"*ast.BinaryExpr", "*ast.BlockExpr", "*ast.IfExpr", "*ast.LetExpr", "*ast.FuncLit",
+		"*ast.CallExpr",
+	} {
+		if !seen[typ] {
+			t.Errorf("%s was not inspected", typ)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// Package doc.
+
+// x is
+// documented.
+val x = 1 // line comment of x
+/* y */ var y = 2 /* a */ /* b */
+
+// not attached
+
+def f(a) = a end // not a value spec
+// f2 doc
+def f2() = 1 end
+let
+	// z doc
+	val z = 3 // z
+in z end
+1 /* inside */ + 2
+// last`
+	parser := Parse("TestComments", input)
+	if len(parser.Errors) > 0 {
+		t.Fatalf("unexpected errors: %s", parser.Errors)
+	}
+	file := parser.File
+
+	var groups []string
+	for _, g := range file.Comments {
+		var texts []string
+		for _, c := range g.List {
+			texts = append(texts, c.Text)
+		}
+		groups = append(groups, strings.Join(texts, "|"))
+	}
+	expectedGroups := []string{
+		"// Package doc.",
+		"// x is|// documented.",
+		"// line comment of x",
+		"/* y */",
+		"/* a */|/* b */",
+		"// not attached",
+		"// not a value spec",
+		"// f2 doc",
+		"// z doc",
+		"// z",
+		"/* inside */",
+		"// last",
+	}
+	if strings.Join(groups, "\n") != strings.Join(expectedGroups, "\n") {
+		t.Errorf("Expected groups:\n%s\nGot:\n%s", strings.Join(expectedGroups, "\n"), strings.Join(groups, "\n"))
+	}
+
+	if text := file.Doc.Text(); text != "Package doc.\n" {
+		t.Errorf("Expected file doc %q, got %q", "Package doc.\n", text)
+	}
+
+	decl := func(i int) ast.Decl { return file.List[i].(*ast.DeclStmt).Decl }
+	x := decl(0).(*ast.GenDecl)
+	if text := x.Doc.Text(); text != "x is\ndocumented.\n" {
+		t.Errorf("x: unexpected doc %q", text)
+	}
+	if text := x.Spec.(*ast.ValueSpec).Comment.Text(); text != "line comment of x\n" {
+		t.Errorf("x: unexpected line comment %q", text)
+	}
+	y := decl(1).(*ast.GenDecl)
+	if y.Doc != nil {
+		t.Errorf("y: unexpected doc %q", y.Doc.Text())
+	}
+	if text := y.Spec.(*ast.ValueSpec).Comment.Text(); text != " a\n b\n" {
+		t.Errorf("y: unexpected line comment %q", text)
+	}
+	if f := decl(2).(*ast.FuncDecl); f.Doc != nil {
+		t.Errorf("f: unexpected doc %q", f.Doc.Text())
+	}
+	if text := decl(3).(*ast.FuncDecl).Doc.Text(); text != "f2 doc\n" {
+		t.Errorf("f2: unexpected doc %q", text)
+	}
+	let := file.List[4].(*ast.ExprStmt).X.(*ast.LetExpr)
+	z := let.Decls[0].(*ast.GenDecl)
+	if z.Doc.Text() != "z doc\n" || z.Spec.(*ast.ValueSpec).Comment.Text() != "z\n" {
+		t.Errorf("z: unexpected doc %q or line comment %q", z.Doc.Text(), z.Spec.(*ast.ValueSpec).Comment.Text())
+	}
+}
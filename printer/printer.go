@@ -0,0 +1,439 @@
+// Package printer implements printing of AST nodes as canonically
+// formatted calc source.
+//
+// Operators are surrounded by single spaces, number literals are
+// printed in their canonical spelling (see ast.BasicLit.Canonical) and
+// statements are printed one per line, keeping at most one blank line
+// between them. An if, let or fn expression or a def declaration that
+// fits on one line in the source and contains no comments is printed on
+// one line; otherwise its bodies are printed on lines of their own,
+// indented by one tab. Comments of a File are kept.
+//
+// Parentheses are printed where the tree has a ParenExpr and, for trees
+// not produced by the parser, only where the precedence of the operators
+// requires them. Since only the layout of the tokens changes, parsing
+// the output of a parsed file yields an ast.Equals tree, and formatting
+// the output again does not change it.
+package printer
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/jonfk/calc/ast"
+	"github.com/jonfk/calc/lex"
+	"io"
+	"strings"
+)
+
+// A printer holds the state of one call to Fprint.
+type printer struct {
+	fset     *lex.FileSet
+	buf      bytes.Buffer
+	indent   int            // current indentation in tabs
+	comments []*ast.Comment // comments not printed yet, in source order
+	lastLine int            // source line of the last node or comment printed
+	lineOpen bool           // text was printed since the last newline
+}
+
+// Fprint formats node as calc source and writes it to output.
+// The positions of the node, which determine where comments and
+// line breaks go, are interpreted relative to fset. If node is an
+// *ast.File, its comments are printed too.
+func Fprint(output io.Writer, fset *lex.FileSet, node ast.Node) error {
+	p := &printer{fset: fset}
+	switch n := node.(type) {
+	case *ast.File:
+		p.file(n)
+	case ast.Expr:
+		p.expr(n)
+	case ast.Stmt:
+		p.stmt(n)
+	case ast.Decl:
+		p.decl(n)
+	default:
+		return fmt.Errorf("printer: unsupported node type %T", node)
+	}
+	_, err := output.Write(p.buf.Bytes())
+	return err
+}
+
+// Source formats a parsed file and returns the resulting source.
+func Source(fset *lex.FileSet, file *ast.File) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := Fprint(&buf, fset, file); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// -----------------------------------------------------------------------------
+// Output
+
+// print writes s, indenting it if it starts a line.
+func (p *printer) print(s string) {
+	if !p.lineOpen {
+		p.buf.WriteString(strings.Repeat("\t", p.indent))
+		p.lineOpen = true
+	}
+	p.buf.WriteString(s)
+}
+
+// newline ends the current line, if any text was printed on it.
+func (p *printer) newline() {
+	if p.lineOpen {
+		p.buf.WriteByte('\n')
+		p.lineOpen = false
+	}
+}
+
+// blankLine ends the current line and prints an empty line, unless
+// nothing was printed yet or the output already ends with one.
+func (p *printer) blankLine() {
+	p.newline()
+	if b := p.buf.Bytes(); len(b) > 0 && !bytes.HasSuffix(b, []byte("\n\n")) {
+		p.buf.WriteByte('\n')
+	}
+}
+
+// line returns the source line of pos, or 0 if it is unknown.
+func (p *printer) line(pos lex.Pos) int {
+	if p.fset == nil {
+		return 0
+	}
+	return p.fset.Position(pos).Line
+}
+
+// setLine records that the source up to end was printed.
+func (p *printer) setLine(end lex.Pos) {
+	if l := p.line(end); l > p.lastLine {
+		p.lastLine = l
+	}
+}
+
+// -----------------------------------------------------------------------------
+// Comments and line breaks
+
+// flush prints the comments before pos. A comment on the source line
+// of the last node printed is appended to the current line, the others
+// are printed on lines of their own.
+func (p *printer) flush(pos lex.Pos) {
+	for len(p.comments) > 0 && p.comments[0].Pos() < pos {
+		c := p.comments[0]
+		p.comments = p.comments[1:]
+		line := p.line(c.Pos())
+		switch {
+		case p.lineOpen && line == p.lastLine:
+			p.print(" ")
+		case line > p.lastLine+1:
+			p.blankLine()
+		default:
+			p.newline()
+		}
+		p.print(c.Text)
+		if strings.HasPrefix(c.Text, "//") {
+			p.newline()
+		}
+		p.setLine(c.End())
+	}
+}
+
+// linebreak ends the current line before printing a node that starts
+// at next. The comments before next are printed first, and a blank
+// line is kept where the source has one or more.
+func (p *printer) linebreak(next lex.Pos) {
+	p.flush(next)
+	if p.line(next) > p.lastLine+1 {
+		p.blankLine()
+	}
+	p.newline()
+}
+
+// hasComments reports whether there are comments between from and to.
+func (p *printer) hasComments(from, to lex.Pos) bool {
+	for _, c := range p.comments {
+		if c.Pos() >= to {
+			break
+		}
+		if c.Pos() >= from {
+			return true
+		}
+	}
+	return false
+}
+
+// oneLine reports whether the construct between from and to is on a
+// single source line without comments, so that it can be printed on
+// one line.
+func (p *printer) oneLine(from, to lex.Pos) bool {
+	return p.line(from) == p.line(to) && !p.hasComments(from, to)
+}
+
+// -----------------------------------------------------------------------------
+// Files, statements and declarations
+
+func (p *printer) file(f *ast.File) {
+	for _, g := range f.Comments {
+		p.comments = append(p.comments, g.List...)
+	}
+	for _, s := range f.List {
+		p.linebreak(s.Pos())
+		p.stmt(s)
+		p.setLine(s.End())
+	}
+	p.flush(lex.Pos(int(^uint(0) >> 1)))
+	p.newline()
+}
+
+func (p *printer) stmt(s ast.Stmt) {
+	switch s := s.(type) {
+	case *ast.BadStmt:
+		p.print("BadStmt")
+	case *ast.ExprStmt:
+		p.expr(s.X)
+	case *ast.AssignStmt:
+		p.expr(s.Lhs)
+		p.print(" = ")
+		p.expr(s.Rhs)
+	case *ast.DeclStmt:
+		p.decl(s.Decl)
+	default:
+		panic(fmt.Sprintf("printer: unexpected statement %T", s))
+	}
+}
+
+func (p *printer) decl(d ast.Decl) {
+	switch d := d.(type) {
+	case *ast.GenDecl:
+		p.print(d.Tok.Val + " ")
+		p.spec(d.Spec)
+	case *ast.FuncDecl:
+		p.print("def " + d.Name.Tok.Val)
+		p.params(d.Params)
+		p.typ(d.Result)
+		p.print(" =")
+		p.body(d.Body, p.oneLine(d.Pos(), d.EndTok.Pos), d.EndTok.Pos)
+		p.print("end")
+	default:
+		panic(fmt.Sprintf("printer: unexpected declaration %T", d))
+	}
+}
+
+func (p *printer) spec(s ast.Spec) {
+	switch s := s.(type) {
+	case *ast.ValueSpec:
+		if s.Pattern != nil {
+			p.expr(s.Pattern)
+		} else {
+			p.expr(s.Name)
+		}
+		p.typ(s.Type)
+		p.print(" = ")
+		p.expr(s.Value)
+	default:
+		panic(fmt.Sprintf("printer: unexpected spec %T", s))
+	}
+}
+
+func (p *printer) params(params *ast.FieldList) {
+	p.print("(")
+	if params != nil {
+		for i, f := range params.List {
+			if i > 0 {
+				p.print(", ")
+			}
+			p.print(f.Name.Tok.Val)
+			p.typ(f.Type)
+		}
+	}
+	p.print(")")
+}
+
+// typ prints the type annotation t following a colon, if t is not nil.
+func (p *printer) typ(t ast.Expr) {
+	if t != nil {
+		p.print(": ")
+		p.expr(t)
+	}
+}
+
+// -----------------------------------------------------------------------------
+// Blocks
+
+// body prints the block following a keyword, and the space or line
+// break before the next keyword at end. If inline is set, the block
+// is printed on the line of the keywords; otherwise its expressions are
+// indented on lines of their own.
+func (p *printer) body(b *ast.BlockExpr, inline bool, end lex.Pos) {
+	if inline {
+		p.print(" ")
+		p.inlineBlock(b)
+		p.print(" ")
+		return
+	}
+	p.setLine(b.Pos())
+	p.indent++
+	for _, x := range b.List {
+		p.linebreak(x.Pos())
+		p.expr(x)
+		p.setLine(x.End())
+	}
+	p.flush(end)
+	p.indent--
+	p.linebreak(end)
+}
+
+// inlineBlock prints the expressions of a block separated by semicolons.
+func (p *printer) inlineBlock(b *ast.BlockExpr) {
+	for i, x := range b.List {
+		if i > 0 {
+			p.print("; ")
+		}
+		p.expr(x)
+	}
+}
+
+// -----------------------------------------------------------------------------
+// Expressions
+
+func (p *printer) expr(x ast.Expr) {
+	switch x := x.(type) {
+	case *ast.BadExpr:
+		p.print("BadExpr")
+	case *ast.Ident:
+		p.print(x.Tok.Val)
+	case *ast.BasicLit:
+		p.print(x.Canonical())
+	case *ast.ParenExpr:
+		p.print("(")
+		if x.X != nil {
+			p.expr(x.X)
+		}
+		p.print(")")
+	case *ast.TupleExpr:
+		p.print("(")
+		p.exprList(x.Elts)
+		p.print(")")
+	case *ast.UnaryExpr:
+		p.print(x.Op.Val)
+		if _, ok := x.X.(*ast.UnaryExpr); ok {
+			// keep the operators apart, since -- or !! is not one
+			p.print(" ")
+		}
+		p.operand(x.X, lex.UnaryPrec, true)
+	case *ast.BinaryExpr:
+		prec := x.Op.Precedence()
+		p.operand(x.X, prec, false)
+		p.print(" " + x.Op.Val + " ")
+		p.operand(x.Y, prec, true)
+	case *ast.BlockExpr:
+		p.inlineBlock(x)
+	case *ast.IfExpr:
+		p.print("if ")
+		p.expr(x.Cond)
+		p.setLine(x.Cond.End())
+		p.print(" then")
+		inline := p.oneLine(x.Pos(), x.EndTok.Pos)
+		if x.Else != nil {
+			p.body(x.Body, inline, x.Else.Pos())
+			p.print("else")
+			p.body(x.Else, inline, x.EndTok.Pos)
+		} else {
+			p.body(x.Body, inline, x.EndTok.Pos)
+		}
+		p.print("end")
+	case *ast.LetExpr:
+		p.letExpr(x)
+	case *ast.FuncLit:
+		p.print("fn ")
+		p.params(x.Params)
+		p.typ(x.Result)
+		p.print(" =>")
+		p.body(x.Body, p.oneLine(x.Pos(), x.EndTok.Pos), x.EndTok.Pos)
+		p.print("end")
+	case *ast.CallExpr:
+		switch x.Fun.(type) {
+		case *ast.Ident, *ast.ParenExpr, *ast.CallExpr:
+			p.expr(x.Fun)
+		default:
+			p.print("(")
+			p.expr(x.Fun)
+			p.print(")")
+		}
+		p.print("(")
+		p.exprList(x.Args)
+		p.print(")")
+	default:
+		panic(fmt.Sprintf("printer: unexpected expression %T", x))
+	}
+}
+
+// operand prints the operand x of an operator of precedence prec, in
+// parentheses if it would not be parsed as the operand otherwise: a
+// binary operand with an operator of lower precedence, or one of the
+// same precedence on the side it does not associate to. Only ** binds
+// tighter than a unary operator, so a unary left operand of ** is
+// enclosed too.
+func (p *printer) operand(x ast.Expr, prec int, right bool) {
+	paren := false
+	switch x := x.(type) {
+	case *ast.BinaryExpr:
+		xprec := x.Op.Precedence()
+		paren = xprec < prec || xprec == prec && right != x.Op.RightAssoc()
+	case *ast.UnaryExpr:
+		paren = !right && prec > lex.UnaryPrec
+	}
+	if paren {
+		p.print("(")
+	}
+	p.expr(x)
+	if paren {
+		p.print(")")
+	}
+}
+
+func (p *printer) exprList(list []ast.Expr) {
+	for i, x := range list {
+		if i > 0 {
+			p.print(", ")
+		}
+		p.expr(x)
+	}
+}
+
+// letExpr prints a let expression on one line if it is on one line in
+// the source, or else as
+//
+//	let
+//		decl
+//	in
+//		body
+//	end
+func (p *printer) letExpr(x *ast.LetExpr) {
+	end := x.EndTok.Pos
+	if p.oneLine(x.Pos(), end) {
+		p.print("let ")
+		for i, d := range x.Decls {
+			if i > 0 {
+				p.print("; ")
+			}
+			p.decl(d)
+		}
+		p.print(" in ")
+		p.inlineBlock(x.Body)
+		p.print(" end")
+		return
+	}
+	p.print("let")
+	p.setLine(x.Pos())
+	p.indent++
+	for _, d := range x.Decls {
+		p.linebreak(d.Pos())
+		p.decl(d)
+		p.setLine(d.End())
+	}
+	p.indent--
+	p.linebreak(x.Body.Pos())
+	p.print("in")
+	p.body(x.Body, false, end)
+	p.print("end")
+}
@@ -0,0 +1,183 @@
+package printer
+
+import (
+	"bytes"
+	"github.com/jonfk/calc/ast"
+	"github.com/jonfk/calc/lex"
+	"github.com/jonfk/calc/parse"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// format parses and formats input.
+func format(t *testing.T, input string) (*ast.File, string) {
+	fset := lex.NewFileSet()
+	file, err := parse.ParseFile(fset, "test", input)
+	if err != nil {
+		t.Fatalf("%q: unexpected error: %s", input, err)
+	}
+	res, err := Source(fset, file)
+	if err != nil {
+		t.Fatalf("%q: unexpected error: %s", input, err)
+	}
+	return file, string(res)
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"4+4*  2", "4 + 4 * 2\n"},
+		{"1;2 ; 3", "1\n2\n3\n"},
+		{"(1+2)*3", "(1 + 2) * 3\n"},
+		{"1%()", "1 % ()\n"},
+		{"- -2", "- -2\n"},
+		{"2**-1*a div b", "2 ** -1 * a div b\n"},
+		{"a<<1|b&c", "a << 1 | b & c\n"},
+		{"!(a==b)", "!(a == b)\n"},
+		{"0X1F\n0B101\n3.\n1.5E+3\n2e-2", "0x1f\n0b101\n3.0\n1.5e3\n2e-2\n"},
+		{"3.i*0X1Fi", "3.0i * 0x1fi\n"},
+		{`"a\n"+'b'`, `"a\n" + 'b'` + "\n"},
+		{"val x=1\nvar (a,(b,c))=(1,(2,3))\nx=2", "val x = 1\nvar (a, (b, c)) = (1, (2, 3))\nx = 2\n"},
+		{"1\n\n\n\n2\n", "1\n\n2\n"},
+		{"\n\n1", "1\n"},
+		{"f(1,\n  2)+g()", "f(1, 2) + g()\n"},
+		{"1 +\n  2", "1 + 2\n"},
+		{"if a then 1 else 2 end", "if a then 1 else 2 end\n"},
+		{"if a then\n1 else 2 end", "if a then\n\t1\nelse\n\t2\nend\n"},
+		{
+			"if a then\nif b then 1 else 2 end\nelse\nlet val c = 1\nin c end\nend",
+			"if a then\n\tif b then 1 else 2 end\nelse\n\tlet\n\t\tval c = 1\n\tin\n\t\tc\n\tend\nend\n",
+		},
+		{"let val a=1;val b=2 in a;b end", "let val a = 1; val b = 2 in a; b end\n"},
+		{"val f = fn(x)=>x end", "val f = fn (x) => x end\n"},
+		{"val f = fn (x) =>\n x\n end", "val f = fn (x) =>\n\tx\nend\n"},
+		{"def f(a,b)=a+b end", "def f(a, b) = a + b end\n"},
+		{"def f() =\n  1\n\n  2\nend", "def f() =\n\t1\n\n\t2\nend\n"},
+		{"(fn (x) => x end)(1)(2)", "(fn (x) => x end)(1)(2)\n"},
+		{"val x:float=3", "val x: float = 3\n"},
+		{"var (a,b) :(int,( string,char))=(1,(\"\",'c'))", "var (a, b): (int, (string, char)) = (1, (\"\", 'c'))\n"},
+		{"def f(a:int,b : float):float=a+b end", "def f(a: int, b: float): float = a + b end\n"},
+		{"fn(x:bool):int=>1 end", "fn (x: bool): int => 1 end\n"},
+
+		// comments
+		{"1 // one\n// two\n2", "1 // one\n// two\n2\n"},
+		{"// doc\n\n\n1", "// doc\n\n1\n"},
+		{"1 /* a */ + /* b */ 2", "1 + 2 /* a */ /* b */\n"},
+		{"/* a */ 1", "/* a */\n1\n"},
+		{"if a then 1 // one\nelse 2 end", "if a then\n\t1 // one\nelse\n\t2\nend\n"},
+		{"def f() = // f\n  1\n  // last\nend", "def f() = // f\n\t1\n\t// last\nend\n"},
+		{"1\n// end", "1\n// end\n"},
+		{"// only", "// only\n"},
+	}
+	for _, test := range tests {
+		_, output := format(t, test.input)
+		if output != test.expected {
+			t.Errorf("%q:\nExpected:\n%s\nGot:\n%s", test.input, test.expected, output)
+		}
+	}
+}
+
+// roundTrip checks that formatting input is idempotent and that
+// reparsing the output gives an equal tree.
+func roundTrip(t *testing.T, name, input string) {
+	file, output := format(t, input)
+	reparsed, again := format(t, output)
+	if !ast.Equals(file, reparsed) {
+		t.Errorf("%s: reparsed tree differs:\nExpected:\n%s\n\nGot:\n%s", name, file, reparsed)
+	}
+	if again != output {
+		t.Errorf("%s: formatting is not idempotent:\nFirst:\n%s\nSecond:\n%s", name, output, again)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	inputs := []string{
+		"-2+3*4",
+		"1 + -2 * 3",
+		"a * -b + c",
+		"(-2) + 3",
+		"-2 ** 2",
+		"(-2) ** 2",
+		"2 ** 3 ** 2",
+		"(2 ** 3) ** 2",
+		"a << 1 | b & 0xff ^ c >> 2",
+		"-(a div b) * 3",
+		"!a && b || c",
+		"1 - (2 - 3) - 4",
+		"val (a, b) = (1, (2, 3))\nvar c = a",
+		"def fact(n) = if n <= 1 then 1 else n * fact(n - 1) end end\nfact(10)",
+		"let\nval a = 1 // a\n\n/* b */ val b = 2\nin\na\n\nb end",
+		"val f = fn (x) =>\n  fn (y) =>\n    x + y\n  end\nend\nf(1)(2)",
+		"f(fn (x) =>\n x // x\nend, 2)",
+		"1 + if a then\n 2\nelse\n 3\nend * 4",
+		"// a\n/* b\n c */\n\n1; 2 // c\n\n\n// d",
+		"0X1F + 3.E+2 - 1.e5",
+		"(1 + 2.5i) * 0X1Fi",
+		"1 % ()",
+		"val x: float = 3\ndef f(a: int,\n  b: (int, float)): int =\n  a\nend",
+	}
+	for _, input := range inputs {
+		roundTrip(t, input, input)
+	}
+
+	names, err := filepath.Glob(filepath.Join("..", "test_input", "*.calc"))
+	if err != nil || len(names) == 0 {
+		t.Fatalf("no test input found: %v", err)
+	}
+	for _, name := range names {
+		input, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		roundTrip(t, name, string(input))
+	}
+}
+
+func TestFprintSynthesized(t *testing.T) {
+	lit := func(typ lex.TokenType, val string) ast.Expr {
+		return &ast.BasicLit{Tok: lex.Token{Typ: typ, Val: val}}
+	}
+	binary := func(x ast.Expr, op lex.TokenType, val string, y ast.Expr) ast.Expr {
+		return &ast.BinaryExpr{X: x, Op: lex.Token{Typ: op, Val: val}, Y: y}
+	}
+	one, two, three := lit(lex.INT, "1"), lit(lex.INT, "2"), lit(lex.INT, "3")
+	tests := []struct {
+		node     ast.Node
+		expected string
+	}{
+		{binary(binary(one, lex.ADD, "+", two), lex.MUL, "*", three), "(1 + 2) * 3"},
+		{binary(one, lex.MUL, "*", binary(two, lex.ADD, "+", three)), "1 * (2 + 3)"},
+		{binary(binary(one, lex.SUB, "-", two), lex.SUB, "-", three), "1 - 2 - 3"},
+		{binary(one, lex.SUB, "-", binary(two, lex.SUB, "-", three)), "1 - (2 - 3)"},
+		{binary(&ast.UnaryExpr{Op: lex.Token{Typ: lex.SUB, Val: "-"}, X: one}, lex.ADD, "+", two), "-1 + 2"},
+		{binary(&ast.UnaryExpr{Op: lex.Token{Typ: lex.SUB, Val: "-"}, X: one}, lex.POW, "**", two), "(-1) ** 2"},
+		{&ast.UnaryExpr{Op: lex.Token{Typ: lex.SUB, Val: "-"}, X: binary(one, lex.ADD, "+", two)}, "-(1 + 2)"},
+		{&ast.UnaryExpr{Op: lex.Token{Typ: lex.SUB, Val: "-"}, X: binary(one, lex.POW, "**", two)}, "-1 ** 2"},
+		{binary(binary(one, lex.POW, "**", two), lex.POW, "**", three), "(1 ** 2) ** 3"},
+		{binary(one, lex.POW, "**", binary(two, lex.POW, "**", three)), "1 ** 2 ** 3"},
+		{binary(lit(lex.FLOAT, "1.E+2"), lex.ADD, "+", lit(lex.INT, "0XFF")), "1.0e2 + 0xff"},
+		{
+			&ast.CallExpr{
+				Fun: &ast.FuncLit{
+					Params: &ast.FieldList{List: []*ast.Field{{Name: ast.NewIdent("x")}}},
+					Body:   &ast.BlockExpr{List: []ast.Expr{ast.NewIdent("x")}},
+				},
+				Args: []ast.Expr{one},
+			},
+			"(fn (x) => x end)(1)",
+		},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := Fprint(&buf, lex.NewFileSet(), test.node); err != nil {
+			t.Errorf("%s: unexpected error: %s", test.expected, err)
+			continue
+		}
+		if buf.String() != test.expected {
+			t.Errorf("Expected %s, got %s", test.expected, buf.String())
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/jonfk/calc/ast"
+	"github.com/jonfk/calc/eval"
+	"github.com/jonfk/calc/lex"
+	"github.com/jonfk/calc/parse"
+	"github.com/jonfk/calc/types"
+	"io"
+	"strings"
+)
+
+const (
+	prompt         = "calc> "
+	continuePrompt = "....> "
+)
+
+const replHelp = `Enter expressions and val, var and def declarations to evaluate them.
+Input continues on the next line while parentheses or blocks are open.
+Commands:
+  :ast <input>     print the syntax tree of input
+  :tokens <input>  print the tokens of input
+  :reset           discard all bindings
+  :mode int|rational
+                   truncate the quotient of two ints or make it an
+                   exact rational number
+  :print fraction|decimal [digits]
+                   print rational numbers as fractions or as decimals
+  :float binary|decimal
+                   compute with binary or decimal floats
+  :precision <digits>
+                   set the number of significant digits of decimal floats
+  :rounding half-even|half-up|down|up|floor|ceiling
+                   set the rounding mode of decimal floats
+  :help            print this message
+  :quit            exit
+`
+
+// A repl is an interactive read-eval-print loop. Bindings made by
+// declarations persist between inputs until :reset.
+// Each input is added to fset, so that errors in functions declared
+// by earlier inputs are reported at their own lines.
+type repl struct {
+	in      *bufio.Scanner
+	out     io.Writer
+	fset    *lex.FileSet
+	checker *types.Checker
+	interp  *eval.Interpreter
+}
+
+// runREPL reads input from r and writes results and errors to w
+// until the input ends or :quit is entered.
+func runREPL(r io.Reader, w io.Writer) {
+	rl := &repl{
+		in:      bufio.NewScanner(r),
+		out:     w,
+		fset:    lex.NewFileSet(),
+		checker: types.New(),
+		interp:  eval.New(),
+	}
+	rl.run()
+}
+
+func (rl *repl) run() {
+	for {
+		input, ok := rl.read()
+		if !ok {
+			fmt.Fprintln(rl.out)
+			return
+		}
+		if line := strings.TrimSpace(input); strings.HasPrefix(line, ":") {
+			if !rl.command(line) {
+				return
+			}
+			continue
+		}
+		rl.eval(input)
+	}
+}
+
+// read reads lines until the parentheses and blocks they open are closed and
+// returns them as one input, or returns a single command line.
+// It returns false at the end of the input.
+func (rl *repl) read() (string, bool) {
+	var buf []string
+	fmt.Fprint(rl.out, prompt)
+	for rl.in.Scan() {
+		line := rl.in.Text()
+		if strings.HasPrefix(strings.TrimSpace(line), ":") {
+			// commands discard any unfinished input
+			return line, true
+		}
+		buf = append(buf, line)
+		input := strings.Join(buf, "\n")
+		if openDepth(input) <= 0 {
+			return input, true
+		}
+		fmt.Fprint(rl.out, continuePrompt)
+	}
+	return "", false
+}
+
+// openDepth returns the number of parentheses and blocks left open in input.
+func openDepth(input string) int {
+	l := lex.Lex("<stdin>", input)
+	blocks := 0
+	for t := l.NextItem(); t.Typ != lex.EOF && t.Typ != lex.ERROR; t = l.NextItem() {
+		switch t.Typ {
+		case lex.IF, lex.LET, lex.FN, lex.DEF:
+			blocks++
+		case lex.END:
+			blocks--
+		}
+	}
+	return l.ParenDepth() + blocks
+}
+
+// command runs a : command and reports whether the loop should continue.
+func (rl *repl) command(line string) bool {
+	name, arg := line, ""
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		name, arg = line[:i], strings.TrimSpace(line[i:])
+	}
+	switch name {
+	case ":quit", ":q":
+		return false
+	case ":reset":
+		rl.checker.Reset()
+		rl.interp.Reset()
+	case ":mode", ":print", ":float", ":precision", ":rounding":
+		if err := rl.interp.SetOption(name[1:], strings.Fields(arg)...); err != nil {
+			fmt.Fprintln(rl.out, err)
+		}
+	case ":help":
+		fmt.Fprint(rl.out, replHelp)
+	case ":ast":
+		p := parse.Parse("<stdin>", arg)
+		rl.printErrors(p.Errors)
+		fmt.Fprintln(rl.out, ast.Sprint(p.File))
+	case ":tokens":
+		l := lex.Lex("<stdin>", arg)
+		var toks []string
+		for t := l.NextItem(); ; t = l.NextItem() {
+			toks = append(toks, t.String())
+			if t.Typ == lex.EOF || t.Typ == lex.ERROR {
+				break
+			}
+		}
+		fmt.Fprintln(rl.out, strings.Join(toks, " "))
+	default:
+		fmt.Fprintf(rl.out, "unknown command %s, try :help\n", name)
+	}
+	return true
+}
+
+// eval parses input and checks and evaluates its statements in order,
+// printing the value of each expression statement. An input that
+// redeclares a global name is evaluated in a new global environment,
+// so that functions declared earlier keep the values they refer to.
+func (rl *repl) eval(input string) {
+	p := parse.ParseIn(rl.fset, "<stdin>", input)
+	if len(p.Errors) > 0 {
+		rl.printErrors(p.Errors)
+		return
+	}
+	for name := range p.File.Scope.Objects {
+		if rl.interp.Global.Bound(name) {
+			rl.interp.Global = eval.NewEnv(rl.interp.Global)
+			break
+		}
+	}
+	if err := rl.interp.Directives(p.File); err != nil {
+		e := err.(*eval.Error)
+		fmt.Fprintf(rl.out, "%s: %s\n", rl.fset.Position(e.Pos), e.Msg)
+		return
+	}
+	for _, stmt := range p.File.List {
+		if _, err := rl.checker.CheckStmt(stmt); err != nil {
+			for _, e := range err.(types.ErrorList) {
+				fmt.Fprintf(rl.out, "%s: %s\n", rl.fset.Position(e.Pos), e.Msg)
+			}
+			return
+		}
+		v, err := rl.interp.EvalStmt(stmt)
+		if err != nil {
+			e := err.(*eval.Error)
+			fmt.Fprintf(rl.out, "%s: %s\n", rl.fset.Position(e.Pos), e.Msg)
+			return
+		}
+		if _, ok := stmt.(*ast.ExprStmt); ok && v != nil {
+			fmt.Fprintln(rl.out, rl.interp.Format(v))
+		}
+	}
+}
+
+func (rl *repl) printErrors(errs parse.ErrorList) {
+	for _, e := range errs {
+		fmt.Fprintln(rl.out, e)
+	}
+}
@@ -0,0 +1,169 @@
+package types
+
+import (
+	"github.com/jonfk/calc/ast"
+)
+
+// A builtin describes a builtin function of the evaluator. Since the
+// builtins accept arguments of several types, which function types
+// cannot express, each one checks its calls itself. Used as a value
+// rather than called, a builtin has the type returned by value, or is
+// an error if it has none.
+type builtin struct {
+	name    string
+	numArgs int
+	check   func(c *Checker, b *builtin, x *ast.CallExpr, args []Type) Type
+	value   func(c *Checker) Type
+}
+
+// universe holds the builtin functions. It is the outermost scope of
+// every Checker, so declarations may shadow them.
+var universe = newScope(nil)
+
+var builtins = []*builtin{
+	{name: "len", numArgs: 1, check: checkLen},
+	{name: "int", numArgs: 1, check: checkInt},
+	{name: "char", numArgs: 1, check: checkChar},
+	{name: "real", numArgs: 1, check: checkComplexPart, value: numericFunc(Float)},
+	{name: "imag", numArgs: 1, check: checkComplexPart, value: numericFunc(Float)},
+	{name: "phase", numArgs: 1, check: checkComplexPart, value: numericFunc(Float)},
+	{name: "abs", numArgs: 1, check: checkAbs},
+	{name: "conj", numArgs: 1, check: checkConj, value: numericFunc(Complex)},
+}
+
+func init() {
+	for _, b := range builtins {
+		universe.entries[b.name] = &entry{kind: ast.Fun, builtin: b}
+	}
+}
+
+// numericFunc returns the value type of a builtin taking a number
+// and returning a result of type result.
+func numericFunc(result Type) func(c *Checker) Type {
+	return func(c *Checker) Type {
+		v := c.newVar()
+		v.numeric = true
+		return &Func{[]Type{v}, result}
+	}
+}
+
+// builtinValue returns the type of b named by x but not called.
+func (c *Checker) builtinValue(x *ast.Ident, b *builtin) Type {
+	if b.value == nil {
+		c.errorf(x.Pos(), "builtin %s must be called", b.name)
+		return Invalid
+	}
+	return b.value(c)
+}
+
+// callBuiltin returns the type of the result of a call to b.
+// The type recorded for the function name, and any parentheses
+// around it, is that of the call.
+func (c *Checker) callBuiltin(x *ast.CallExpr, b *builtin, sc *scope) Type {
+	args := make([]Type, len(x.Args))
+	for i, arg := range x.Args {
+		args[i] = c.expr(arg, sc)
+	}
+	if len(args) != b.numArgs {
+		c.errorf(x.Pos(), "wrong number of arguments in call to %s: have %d, want %d", b.name, len(args), b.numArgs)
+		c.recordFun(x.Fun, Invalid)
+		return Invalid
+	}
+	result := b.check(c, b, x, args)
+	c.recordFun(x.Fun, &Func{args, result})
+	return result
+}
+
+// recordFun records t as the type of fun and of the expressions
+// inside any parentheses around it.
+func (c *Checker) recordFun(fun ast.Expr, t Type) {
+	for {
+		c.record(fun, t)
+		p, ok := fun.(*ast.ParenExpr)
+		if !ok || p.X == nil {
+			return
+		}
+		fun = p.X
+	}
+}
+
+// checkLen accepts a string or a tuple.
+func checkLen(c *Checker, b *builtin, x *ast.CallExpr, args []Type) Type {
+	switch t := prune(args[0]).(type) {
+	case *Tuple, *Var:
+		return Int
+	case Basic:
+		if t == String || t == Invalid {
+			return Int
+		}
+	}
+	c.errorf(x.Args[0].Pos(), "invalid argument of type %s for len", args[0])
+	return Int
+}
+
+// checkInt accepts an int or a char.
+func checkInt(c *Checker, b *builtin, x *ast.CallExpr, args []Type) Type {
+	if !convertible(args[0]) {
+		c.errorf(x.Args[0].Pos(), "cannot convert value of type %s to int", args[0])
+	}
+	return Int
+}
+
+// checkChar accepts an int or a char.
+func checkChar(c *Checker, b *builtin, x *ast.CallExpr, args []Type) Type {
+	if !convertible(args[0]) {
+		c.errorf(x.Args[0].Pos(), "cannot convert value of type %s to char", args[0])
+	}
+	return Char
+}
+
+// convertible reports whether a value of type t may be an int or a char.
+func convertible(t Type) bool {
+	switch t := prune(t).(type) {
+	case *Var:
+		return true
+	case Basic:
+		return t == Int || t == Char || t == Invalid
+	}
+	return false
+}
+
+// checkComplexPart accepts a number, which real, imag and phase treat
+// as a complex, and returns a float.
+func checkComplexPart(c *Checker, b *builtin, x *ast.CallExpr, args []Type) Type {
+	c.numericArg(x, b.name, args[0])
+	return Float
+}
+
+// checkConj accepts a number, which it treats as a complex.
+func checkConj(c *Checker, b *builtin, x *ast.CallExpr, args []Type) Type {
+	c.numericArg(x, b.name, args[0])
+	return Complex
+}
+
+// checkAbs accepts a number. The absolute value of an int is an int,
+// and that of a float or a complex a float. The absolute value of an
+// argument whose type is not known yet is given the same type.
+func checkAbs(c *Checker, b *builtin, x *ast.CallExpr, args []Type) Type {
+	t := c.numericArg(x, b.name, args[0])
+	if t == Complex {
+		return Float
+	}
+	return t
+}
+
+// numericArg reports an error unless t, the type of the argument of a
+// call to the builtin name taking a number, is numeric, and returns it.
+func (c *Checker) numericArg(x *ast.CallExpr, name string, t Type) Type {
+	switch t := prune(t).(type) {
+	case *Var:
+		t.numeric = true
+		return t
+	case Basic:
+		if t == Invalid || isNumeric(t) {
+			return t
+		}
+	}
+	c.errorf(x.Args[0].Pos(), "invalid argument of type %s for %s", t, name)
+	return Invalid
+}
@@ -0,0 +1,988 @@
+// Package types implements type inference and checking for calc
+// programs produced by the parse package.
+//
+// Every expression has one of the basic types int, float, complex, bool,
+// string and char, a tuple type such as (int, string), or a function type such
+// as func(int, int) bool. Declarations and parameters may be annotated
+// with a basic or tuple type, as in
+//
+//	val x: float = 3
+//	def f(a: int, b: (int, string)): int = ... end
+//
+// Without an annotation, the type of a parameter is inferred from the
+// way it is used: a parameter used as an if condition is a bool, one
+// that is added to a string is a string. A parameter whose use does not
+// determine a type, such as x in
+//
+//	def id(x) = x end
+//
+// has a type variable 'a as its type, and a function declared with def
+// or a val bound to a function literal is generic in such variables:
+// id(1) is an int and id("a") a string. The operators applied to them
+// are checked again at each use, so that with
+//
+//	def add(a, b) = a + b end
+//
+// add(1, 2.5) is a float and add(true, 1) an error.
+//
+// The rules follow the evaluator. Arithmetic on two ints yields an int,
+// on an int and a float a float, and on a complex and another number a
+// complex; strings are concatenated with +; ints, floats, strings and
+// chars are ordered; complex numbers and bools are only compared for
+// equality; && and || take bools. The branches of an if expression
+// must have the same type. The int type is that of exact numbers: the
+// evaluator's ints grow past 64 bits instead of overflowing, and in its
+// rational mode the quotient of two ints is an exact rational number,
+// which is an int to the checker as well. The evaluator reports an
+// error if one that is not an integer is used where only an integer
+// will do: as an operand of % or of a bitwise operator, as the argument
+// of char, or as a value annotated as int.
+//
+// An int is widened to a float, and an int or a float to a complex, and
+// converted by the evaluator, only where a float or a complex is
+// expected: as the value of a declaration, argument or function result
+// annotated as such, also as an element of a tuple, and when assigned
+// to a float or complex var. Nothing is ever narrowed.
+package types
+
+import (
+	"fmt"
+	"github.com/jonfk/calc/ast"
+	"github.com/jonfk/calc/lex"
+)
+
+// A Checker infers the types of statements and expressions.
+// Top-level declarations are kept between calls so that a program
+// can be checked one statement at a time, as it is evaluated.
+type Checker struct {
+	// Types maps every expression checked to its type, including
+	// the identifiers declared by declarations and parameter lists.
+	// The types are final once the statement containing the
+	// expression has been checked.
+	Types map[ast.Expr]Type
+
+	global   *scope
+	level    int           // let-nesting depth of the declaration being checked
+	nextID   int           // id of the next type variable
+	errors   ErrorList     // errors of the current call
+	pending  []*constraint // operations on operands of unknown types
+	checked  []ast.Expr    // expressions recorded since the last statement
+	declared []*ast.Ident  // identifiers declared since the last statement
+}
+
+// New returns a Checker with an empty global scope.
+// The builtin functions are visible in it.
+func New() *Checker {
+	return &Checker{
+		Types:  make(map[ast.Expr]Type),
+		global: newScope(universe),
+	}
+}
+
+// Reset discards all global declarations.
+func (c *Checker) Reset() {
+	c.global = newScope(universe)
+}
+
+// Check infers the types of the statements of f with a new Checker
+// and returns the type of every expression.
+func Check(f *ast.File) (map[ast.Expr]Type, error) {
+	c := New()
+	err := c.CheckFile(f)
+	return c.Types, err
+}
+
+// CheckFile checks every statement in f in order. It reports all the
+// errors found; a name declared by a statement with errors is still
+// visible to the following statements.
+func (c *Checker) CheckFile(f *ast.File) error {
+	for _, s := range f.List {
+		c.stmt(s, c.global)
+		c.finish()
+	}
+	return c.err()
+}
+
+// CheckStmt checks a single statement in the global scope and returns
+// its type, which is nil for declarations and assignments. If the
+// statement has errors, the names it declares are not kept. A
+// statement that redeclares a global name opens a new global scope,
+// so that the earlier declaration is shadowed rather than replaced.
+func (c *Checker) CheckStmt(s ast.Stmt) (Type, error) {
+	top := newScope(c.global)
+	t := c.stmt(s, top)
+	c.finish()
+	if err := c.err(); err != nil {
+		return nil, err
+	}
+	redeclared := false
+	for name := range top.entries {
+		if _, ok := c.global.entries[name]; ok {
+			redeclared = true
+		}
+	}
+	if redeclared {
+		c.global = top
+	} else {
+		for name, e := range top.entries {
+			c.global.entries[name] = e
+		}
+	}
+	if t == nil {
+		return nil, nil
+	}
+	return resolve(t), nil
+}
+
+// errorf records an error at pos.
+func (c *Checker) errorf(pos lex.Pos, format string, args ...interface{}) {
+	c.errors = append(c.errors, &Error{pos, fmt.Sprintf(format, args...)})
+}
+
+// err returns the errors recorded since the last call, sorted by position.
+func (c *Checker) err() error {
+	list := c.errors
+	c.errors = nil
+	list.Sort()
+	return list.Err()
+}
+
+// finish completes the checking of a top-level statement: it checks
+// the operations whose operand types became known and resolves the
+// types recorded for the statement.
+func (c *Checker) finish() {
+	c.solve()
+	c.pending = nil
+	for _, x := range c.checked {
+		c.Types[x] = resolve(c.Types[x])
+	}
+	c.checked = nil
+	for _, ident := range c.declared {
+		if ident.Obj != nil {
+			ident.Obj.Type = c.Types[ident]
+		}
+	}
+	c.declared = nil
+}
+
+// record records t as the type of x and returns it.
+func (c *Checker) record(x ast.Expr, t Type) Type {
+	c.Types[x] = t
+	c.checked = append(c.checked, x)
+	return t
+}
+
+// -----------------------------------------------------------------------------
+// Scopes
+
+// An entry is the declaration of a name in a scope.
+type entry struct {
+	kind        ast.ObjKind
+	typ         Type
+	generic     []*Var        // type variables of typ replaced by new ones at each use
+	constraints []*constraint // operations on the generic type variables
+	builtin     *builtin      // builtin function; or nil
+}
+
+type scope struct {
+	outer   *scope
+	entries map[string]*entry
+}
+
+func newScope(outer *scope) *scope {
+	return &scope{outer, make(map[string]*entry)}
+}
+
+// lookup returns the entry for name in s or its outer scopes, or nil.
+func (s *scope) lookup(name string) *entry {
+	for ; s != nil; s = s.outer {
+		if e, ok := s.entries[name]; ok {
+			return e
+		}
+	}
+	return nil
+}
+
+// declare declares ident with type t in s. If generalize is set, the
+// type variables of t that were created inside the declaration are
+// generic.
+func (c *Checker) declare(ident *ast.Ident, kind ast.ObjKind, t Type, generalize bool, s *scope) {
+	e := &entry{kind: kind, typ: t}
+	if generalize {
+		c.solve()
+		e.generic = c.generic(t)
+		for _, k := range c.pending {
+			if k.mentions(e.generic) {
+				e.constraints = append(e.constraints, k)
+			}
+		}
+	}
+	s.entries[ident.Tok.Val] = e
+	c.record(ident, t)
+	c.declared = append(c.declared, ident)
+}
+
+// generic returns the unbound type variables of t created at a deeper
+// level than the current one.
+func (c *Checker) generic(t Type) []*Var {
+	var vars []*Var
+	seen := make(map[*Var]bool)
+	var collect func(t Type)
+	collect = func(t Type) {
+		switch t := prune(t).(type) {
+		case *Var:
+			if t.level > c.level && !seen[t] {
+				seen[t] = true
+				vars = append(vars, t)
+			}
+		case *Tuple:
+			for _, e := range t.Elems {
+				collect(e)
+			}
+		case *Func:
+			for _, p := range t.Params {
+				collect(p)
+			}
+			collect(t.Result)
+		}
+	}
+	collect(t)
+	return vars
+}
+
+// instantiate returns the type of e, used by ident, with new type
+// variables in place of its generic ones. The operations on the generic
+// variables are checked again for the new ones; their errors are
+// reported at ident.
+func (c *Checker) instantiate(e *entry, ident *ast.Ident) Type {
+	if len(e.generic) == 0 {
+		return e.typ
+	}
+	m := make(map[*Var]Type, len(e.generic))
+	for _, v := range e.generic {
+		nv := c.newVar()
+		nv.numeric = v.numeric
+		m[v] = nv
+	}
+	for _, k := range e.constraints {
+		c.pending = append(c.pending, &constraint{
+			op:     k.op,
+			x:      subst(k.x, m),
+			y:      subst(k.y, m),
+			result: subst(k.result, m),
+			pos:    ident.Pos(),
+			in:     ident.Tok.Val,
+		})
+	}
+	return subst(e.typ, m)
+}
+
+func subst(t Type, m map[*Var]Type) Type {
+	switch t := prune(t).(type) {
+	case *Var:
+		if s, ok := m[t]; ok {
+			return s
+		}
+		return t
+	case *Tuple:
+		elems := make([]Type, len(t.Elems))
+		for i, e := range t.Elems {
+			elems[i] = subst(e, m)
+		}
+		return &Tuple{elems}
+	case *Func:
+		params := make([]Type, len(t.Params))
+		for i, p := range t.Params {
+			params[i] = subst(p, m)
+		}
+		return &Func{params, subst(t.Result, m)}
+	default:
+		return t
+	}
+}
+
+// -----------------------------------------------------------------------------
+// Unification
+
+// newVar returns a new unbound type variable.
+func (c *Checker) newVar() *Var {
+	c.nextID++
+	return &Var{id: c.nextID, level: c.level}
+}
+
+// unify makes x and y the same type by binding type variables and
+// reports whether it succeeded. Invalid unifies with every type.
+func (c *Checker) unify(x, y Type) bool {
+	x, y = prune(x), prune(y)
+	if x == Invalid || y == Invalid {
+		return true
+	}
+	if v, ok := x.(*Var); ok {
+		return bindVar(v, y)
+	}
+	if v, ok := y.(*Var); ok {
+		return bindVar(v, x)
+	}
+	switch x := x.(type) {
+	case Basic:
+		return x == y
+	case *Tuple:
+		y, ok := y.(*Tuple)
+		return ok && c.unifyList(x.Elems, y.Elems)
+	case *Func:
+		y, ok := y.(*Func)
+		return ok && c.unifyList(x.Params, y.Params) && c.unify(x.Result, y.Result)
+	}
+	return false
+}
+
+func (c *Checker) unifyList(x, y []Type) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	for i := range x {
+		if !c.unify(x[i], y[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// bindVar binds v to t unless t contains v or v is numeric and t is
+// not.
+func bindVar(v *Var, t Type) bool {
+	if t == v {
+		return true
+	}
+	if v.numeric {
+		switch t := t.(type) {
+		case *Var:
+			t.numeric = true
+		case Basic:
+			if !isNumeric(t) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	if !adjust(t, v) {
+		return false
+	}
+	v.bound = t
+	return true
+}
+
+// adjust lowers the level of the type variables of t to the level of
+// v, so that they are not generalized where v is not, and reports
+// whether t does not contain v.
+func adjust(t Type, v *Var) bool {
+	switch t := prune(t).(type) {
+	case *Var:
+		if t == v {
+			return false
+		}
+		if t.level > v.level {
+			t.level = v.level
+		}
+	case *Tuple:
+		for _, e := range t.Elems {
+			if !adjust(e, v) {
+				return false
+			}
+		}
+	case *Func:
+		for _, p := range t.Params {
+			if !adjust(p, v) {
+				return false
+			}
+		}
+		return adjust(t.Result, v)
+	}
+	return true
+}
+
+// assignable reports whether a value of type x can be used where a
+// value of type y is expected, unifying them if needed. An int can be
+// used as a float and an int or a float as a complex, also as an
+// element of a tuple; the evaluator converts it.
+func (c *Checker) assignable(x, y Type) bool {
+	x, y = prune(x), prune(y)
+	if x == Int && y == Float || (x == Int || x == Float) && y == Complex {
+		return true
+	}
+	if xt, ok := x.(*Tuple); ok {
+		if yt, ok := y.(*Tuple); ok && len(xt.Elems) == len(yt.Elems) {
+			for i := range xt.Elems {
+				if !c.assignable(xt.Elems[i], yt.Elems[i]) {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	return c.unify(x, y)
+}
+
+// -----------------------------------------------------------------------------
+// Statements and declarations
+
+func (c *Checker) stmt(s ast.Stmt, sc *scope) Type {
+	switch s := s.(type) {
+	case *ast.ExprStmt:
+		return c.expr(s.X, sc)
+	case *ast.DeclStmt:
+		c.decl(s.Decl, sc)
+	case *ast.AssignStmt:
+		rhs := c.expr(s.Rhs, sc)
+		ident, ok := s.Lhs.(*ast.Ident)
+		if !ok {
+			c.errorf(s.Lhs.Pos(), "cannot assign to %s", ast.Sprint(s.Lhs))
+			return nil
+		}
+		e := sc.lookup(ident.Tok.Val)
+		if e == nil {
+			c.errorf(ident.Pos(), "undeclared name: %s", ident.Tok.Val)
+			return nil
+		}
+		if e.kind != ast.Var {
+			c.errorf(ident.Pos(), "cannot assign to %s %s", e.kind, ident.Tok.Val)
+		}
+		t := c.record(ident, c.instantiate(e, ident))
+		if !c.assignable(rhs, t) {
+			c.errorf(s.Rhs.Pos(), "cannot assign %s value to %s of type %s", rhs, ident.Tok.Val, t)
+		}
+	}
+	return nil
+}
+
+func (c *Checker) decl(d ast.Decl, sc *scope) {
+	switch d := d.(type) {
+	case *ast.GenDecl:
+		spec, ok := d.Spec.(*ast.ValueSpec)
+		if !ok {
+			return
+		}
+		kind := ast.Val
+		if d.Tok.Typ == lex.VAR {
+			kind = ast.Var
+		}
+		// Only functions bound to a val are generic, since the value
+		// of a var may be replaced by one of another type.
+		_, isFunc := spec.Value.(*ast.FuncLit)
+		generalize := isFunc && kind == ast.Val && spec.Pattern == nil
+		if generalize {
+			c.level++
+		}
+		t := c.expr(spec.Value, sc)
+		if generalize {
+			c.level--
+		}
+		if spec.Type != nil {
+			declared := c.typeExpr(spec.Type)
+			if !c.assignable(t, declared) {
+				c.errorf(spec.Value.Pos(), "cannot use %s value as %s in declaration", t, declared)
+			}
+			t = declared
+		}
+		if spec.Pattern != nil {
+			c.bind(spec.Pattern, kind, t, sc)
+		} else {
+			c.declare(spec.Name, kind, t, generalize, sc)
+		}
+	case *ast.FuncDecl:
+		// The function is declared before its body is checked so that
+		// it may call itself; the recursive calls are not generic.
+		c.level++
+		ft := c.newFunc(d.Params, d.Result)
+		sc.entries[d.Name.Tok.Val] = &entry{kind: ast.Fun, typ: ft}
+		c.funcBody(ft, d.Params, d.Result, d.Body, sc)
+		c.level--
+		c.declare(d.Name, ast.Fun, ft, true, sc)
+	}
+}
+
+// bind declares the names of a tuple pattern with the types of the
+// corresponding elements of a value of type t.
+func (c *Checker) bind(pattern *ast.TupleExpr, kind ast.ObjKind, t Type, sc *scope) {
+	c.record(pattern, t)
+	elems := make([]Type, len(pattern.Elts))
+	switch tt := prune(t).(type) {
+	case *Tuple:
+		if len(tt.Elems) == len(pattern.Elts) {
+			copy(elems, tt.Elems)
+			break
+		}
+		c.errorf(pattern.Pos(), "tuple pattern has %d elements but value of type %s has %d", len(pattern.Elts), t, len(tt.Elems))
+		for i := range elems {
+			elems[i] = Invalid
+		}
+	case *Var:
+		for i := range elems {
+			elems[i] = c.newVar()
+		}
+		if c.unify(tt, &Tuple{elems}) {
+			break
+		}
+		c.errorf(pattern.Pos(), "cannot destructure %s value into %d names", t, len(pattern.Elts))
+		for i := range elems {
+			elems[i] = Invalid
+		}
+	default:
+		if t != Invalid {
+			c.errorf(pattern.Pos(), "cannot destructure %s value into %d names", t, len(pattern.Elts))
+		}
+		for i := range elems {
+			elems[i] = Invalid
+		}
+	}
+	for i, x := range pattern.Elts {
+		switch x := x.(type) {
+		case *ast.Ident:
+			c.declare(x, kind, elems[i], false, sc)
+		case *ast.TupleExpr:
+			c.bind(x, kind, elems[i], sc)
+		}
+	}
+}
+
+// newFunc returns the type of a function with the given parameters and
+// result type. The parameters and result without a type annotation get
+// a new type variable.
+func (c *Checker) newFunc(params *ast.FieldList, result ast.Expr) *Func {
+	ft := &Func{Result: c.newVar()}
+	if result != nil {
+		ft.Result = c.typeExpr(result)
+	}
+	for _, f := range params.List {
+		if f.Type != nil {
+			ft.Params = append(ft.Params, c.typeExpr(f.Type))
+		} else {
+			ft.Params = append(ft.Params, c.newVar())
+		}
+	}
+	return ft
+}
+
+// funcBody checks the body of a function of type ft in a new scope
+// nested in sc in which the parameters are declared.
+func (c *Checker) funcBody(ft *Func, params *ast.FieldList, result ast.Expr, body *ast.BlockExpr, sc *scope) {
+	inner := newScope(sc)
+	for i, f := range params.List {
+		c.declare(f.Name, ast.Val, ft.Params[i], false, inner)
+	}
+	t := c.expr(body, inner)
+	switch {
+	case result != nil:
+		if !c.assignable(t, ft.Result) {
+			c.errorf(body.Pos(), "cannot use %s value as %s result", t, ft.Result)
+		}
+	case !c.unify(ft.Result, t):
+		c.errorf(body.Pos(), "function body of type %s does not match result type %s of recursive calls", t, ft.Result)
+	}
+}
+
+// typeExpr returns the type denoted by a type annotation and records it.
+func (c *Checker) typeExpr(x ast.Expr) Type {
+	var t Type = Invalid
+	switch x := x.(type) {
+	case *ast.Ident:
+		switch x.Tok.Val {
+		case "int":
+			t = Int
+		case "float":
+			t = Float
+		case "complex":
+			t = Complex
+		case "bool":
+			t = Bool
+		case "string":
+			t = String
+		case "char":
+			t = Char
+		default:
+			c.errorf(x.Pos(), "unknown type %s", x.Tok.Val)
+		}
+	case *ast.TupleExpr:
+		elems := make([]Type, len(x.Elts))
+		for i, e := range x.Elts {
+			elems[i] = c.typeExpr(e)
+		}
+		t = &Tuple{elems}
+	}
+	if x != nil {
+		c.record(x, t)
+	}
+	return t
+}
+
+// -----------------------------------------------------------------------------
+// Expressions
+
+// expr infers the type of x and records it.
+func (c *Checker) expr(x ast.Expr, sc *scope) Type {
+	if x == nil {
+		return Invalid
+	}
+	return c.record(x, c.exprType(x, sc))
+}
+
+func (c *Checker) exprType(x ast.Expr, sc *scope) Type {
+	switch x := x.(type) {
+	case *ast.BasicLit:
+		switch x.Tok.Typ {
+		case lex.INT:
+			return Int
+		case lex.FLOAT:
+			return Float
+		case lex.IMAG:
+			return Complex
+		case lex.BOOL:
+			return Bool
+		case lex.STRING:
+			return String
+		case lex.CHAR:
+			return Char
+		}
+		return Invalid
+	case *ast.Ident:
+		e := sc.lookup(x.Tok.Val)
+		if e == nil {
+			c.errorf(x.Pos(), "undeclared name: %s", x.Tok.Val)
+			return Invalid
+		}
+		if e.builtin != nil {
+			return c.builtinValue(x, e.builtin)
+		}
+		return c.instantiate(e, x)
+	case *ast.ParenExpr:
+		if x.X == nil {
+			c.errorf(x.Pos(), "empty parenthesized expression has no value")
+			return Invalid
+		}
+		return c.expr(x.X, sc)
+	case *ast.UnaryExpr:
+		return c.unary(x.Op, c.expr(x.X, sc))
+	case *ast.BinaryExpr:
+		switch x.Op.Typ {
+		case lex.LAND, lex.LOR:
+			for _, y := range []ast.Expr{x.X, x.Y} {
+				if t := c.expr(y, sc); !c.unify(t, Bool) {
+					c.errorf(y.Pos(), "operator %s requires bool operands, have %s", x.Op.Val, t)
+				}
+			}
+			return Bool
+		}
+		return c.binary(x.Op, c.expr(x.X, sc), c.expr(x.Y, sc))
+	case *ast.BlockExpr:
+		var t Type = Invalid
+		for _, y := range x.List {
+			t = c.expr(y, sc)
+		}
+		return t
+	case *ast.IfExpr:
+		if t := c.expr(x.Cond, sc); !c.unify(t, Bool) {
+			c.errorf(x.Cond.Pos(), "non-bool condition of type %s in if expression", t)
+		}
+		body := prune(c.expr(x.Body, sc))
+		els := prune(c.expr(x.Else, sc))
+		if !c.unify(body, els) {
+			c.errorf(x.Pos(), "mismatched types %s and %s of if expression branches", body, els)
+			return Invalid
+		}
+		return body
+	case *ast.LetExpr:
+		inner := newScope(sc)
+		for _, d := range x.Decls {
+			c.decl(d, inner)
+		}
+		return c.expr(x.Body, inner)
+	case *ast.TupleExpr:
+		t := &Tuple{make([]Type, len(x.Elts))}
+		for i, y := range x.Elts {
+			t.Elems[i] = c.expr(y, sc)
+		}
+		return t
+	case *ast.FuncLit:
+		ft := c.newFunc(x.Params, x.Result)
+		c.funcBody(ft, x.Params, x.Result, x.Body, sc)
+		return ft
+	case *ast.CallExpr:
+		return c.call(x, sc)
+	}
+	return Invalid
+}
+
+func (c *Checker) unary(op lex.Token, x Type) Type {
+	x = prune(x)
+	switch op.Typ {
+	case lex.ADD, lex.SUB:
+		if v, ok := x.(*Var); ok {
+			v.numeric = true
+			return x
+		}
+		if x == Invalid || isNumeric(x) {
+			return x
+		}
+	case lex.NOT:
+		if c.unify(x, Bool) {
+			return Bool
+		}
+	}
+	c.errorf(op.Pos, "invalid operation: operator %s not defined on %s", op.Val, x)
+	return Invalid
+}
+
+// binary returns the type of a binary operation other than && and ||.
+//
+// An operand whose type is a type variable that is used with a string,
+// char or bool operand must have the same type as it. Used with an int,
+// a float or a complex operand the variable becomes numeric, and used with
+// another type variable it may stand for any type the operator is
+// defined on; either way, the types of the operands determine the type
+// of the result. The operation is then checked once the statement has
+// been checked, if both operand types are known by then. The operands
+// of div and of the bitwise operators are ints, so their type
+// variables are bound to int.
+func (c *Checker) binary(op lex.Token, x, y Type) Type {
+	x, y = prune(x), prune(y)
+	if x == Invalid || y == Invalid {
+		return Invalid
+	}
+	if isIntOnly(op) {
+		for _, t := range []Type{x, y} {
+			if _, ok := t.(*Var); ok {
+				c.unify(t, Int)
+			}
+		}
+		x, y = prune(x), prune(y)
+	}
+	_, xvar := x.(*Var)
+	_, yvar := y.(*Var)
+	if xvar || yvar {
+		other := x
+		if xvar {
+			other = y
+		}
+		switch o := other.(type) {
+		case Basic:
+			if !isNumeric(o) {
+				if !c.unify(x, y) {
+					c.errorf(op.Pos, "invalid operation: operator %s not defined on %s and %s", op.Val, x, y)
+					return Invalid
+				}
+				return c.binary(op, x, y)
+			}
+			for _, t := range []Type{x, y} {
+				if v, ok := t.(*Var); ok {
+					v.numeric = true
+				}
+			}
+		case *Tuple, *Func:
+			c.errorf(op.Pos, "invalid operation: operator %s not defined on %s", op.Val, other)
+			return Invalid
+		}
+		var result Type = Bool
+		if !isComparison(op) {
+			result = c.newVar()
+		}
+		c.pending = append(c.pending, &constraint{op: op, x: x, y: y, result: result, pos: op.Pos})
+		return result
+	}
+	if t, ok := binaryType(op, x, y); ok {
+		return t
+	}
+	c.errorf(op.Pos, "invalid operation: operator %s not defined on %s and %s", op.Val, x, y)
+	return Invalid
+}
+
+// binaryType returns the type of the result of op applied to operands
+// of the known types x and y, and whether op is defined on them.
+func binaryType(op lex.Token, x, y Type) (Type, bool) {
+	arith := false
+	switch op.Typ {
+	case lex.ADD, lex.SUB, lex.MUL, lex.QUO, lex.REM, lex.POW:
+		arith = true
+	default:
+		if isIntOnly(op) {
+			return Int, x == Int && y == Int
+		}
+		if !isComparison(op) {
+			return nil, false
+		}
+	}
+	switch {
+	case x == Int && y == Int:
+		if arith {
+			return Int, true
+		}
+		return Bool, true
+	case isNumeric(x) && isNumeric(y) && (x == Complex || y == Complex):
+		if arith {
+			return Complex, op.Typ != lex.REM
+		}
+		return Bool, op.Typ == lex.EQL || op.Typ == lex.NEQ
+	case isNumeric(x) && isNumeric(y):
+		if arith {
+			return Float, true
+		}
+		return Bool, true
+	case x == String && y == String:
+		if op.Typ == lex.ADD {
+			return String, true
+		}
+		return Bool, !arith
+	case x == Char && y == Char:
+		return Bool, !arith
+	case x == Bool && y == Bool:
+		return Bool, op.Typ == lex.EQL || op.Typ == lex.NEQ
+	}
+	return nil, false
+}
+
+// isIntOnly reports whether op is only defined on ints.
+func isIntOnly(op lex.Token) bool {
+	switch op.Typ {
+	case lex.DIV, lex.AND, lex.OR, lex.XOR, lex.SHL, lex.SHR:
+		return true
+	}
+	return false
+}
+
+func isComparison(op lex.Token) bool {
+	switch op.Typ {
+	case lex.EQL, lex.NEQ, lex.LSS, lex.LEQ, lex.GTR, lex.GEQ:
+		return true
+	}
+	return false
+}
+
+// call returns the type of the result of a function call.
+func (c *Checker) call(x *ast.CallExpr, sc *scope) Type {
+	name := "function"
+	callee := x.Fun
+	for p, ok := callee.(*ast.ParenExpr); ok && p.X != nil; p, ok = callee.(*ast.ParenExpr) {
+		callee = p.X
+	}
+	if ident, ok := callee.(*ast.Ident); ok {
+		name = ident.Tok.Val
+		if e := sc.lookup(name); e != nil && e.builtin != nil {
+			return c.callBuiltin(x, e.builtin, sc)
+		}
+	}
+	fun := prune(c.expr(x.Fun, sc))
+	args := make([]Type, len(x.Args))
+	for i, arg := range x.Args {
+		args[i] = c.expr(arg, sc)
+	}
+	switch f := fun.(type) {
+	case *Func:
+		if len(args) != len(f.Params) {
+			c.errorf(x.Pos(), "wrong number of arguments in call to %s: have %d, want %d", name, len(args), len(f.Params))
+			return f.Result
+		}
+		for i, arg := range args {
+			if !c.assignable(arg, f.Params[i]) {
+				want := f.Params[i].String()
+				if v, ok := prune(f.Params[i]).(*Var); ok && v.numeric {
+					want = "numeric"
+				}
+				c.errorf(x.Args[i].Pos(), "cannot use %s value as %s argument in call to %s", arg, want, name)
+			}
+		}
+		c.solve()
+		return f.Result
+	case *Var:
+		result := c.newVar()
+		if c.unify(f, &Func{args, result}) {
+			return result
+		}
+	}
+	if fun != Invalid {
+		c.errorf(x.Fun.Pos(), "cannot call non-function value of type %s", fun)
+	}
+	return Invalid
+}
+
+// -----------------------------------------------------------------------------
+// Constraints
+
+// A constraint is a binary operation whose operand types were not known
+// when it was checked. Its result type is determined once they are.
+type constraint struct {
+	op     lex.Token
+	x, y   Type
+	result Type
+	pos    lex.Pos // position at which errors are reported
+	in     string  // name of the generic function the operation is in; or ""
+}
+
+// solve checks the pending operations whose operand types are known,
+// until no more become known.
+func (c *Checker) solve() {
+	for progress := true; progress; {
+		progress = false
+		var pending []*constraint
+		for _, k := range c.pending {
+			if c.apply(k) {
+				progress = true
+			} else {
+				pending = append(pending, k)
+			}
+		}
+		c.pending = pending
+	}
+}
+
+// apply checks the operation k if the types of its operands are known,
+// binding its result type, and reports whether it did.
+func (c *Checker) apply(k *constraint) bool {
+	x, y := prune(k.x), prune(k.y)
+	if _, ok := x.(*Var); ok {
+		return false
+	}
+	if _, ok := y.(*Var); ok {
+		return false
+	}
+	if x == Invalid || y == Invalid {
+		return true
+	}
+	in := ""
+	if k.in != "" {
+		in = " in " + k.in
+	}
+	t, ok := binaryType(k.op, x, y)
+	if !ok {
+		c.errorf(k.pos, "invalid operation: operator %s not defined on %s and %s%s", k.op.Val, x, y, in)
+	} else if !c.unify(k.result, t) {
+		c.errorf(k.pos, "result of operator %s of type %s used as %s%s", k.op.Val, t, k.result, in)
+	}
+	return true
+}
+
+// mentions reports whether the types of k contain one of vars.
+func (k *constraint) mentions(vars []*Var) bool {
+	found := false
+	var visit func(t Type)
+	visit = func(t Type) {
+		switch t := prune(t).(type) {
+		case *Var:
+			for _, v := range vars {
+				found = found || v == t
+			}
+		case *Tuple:
+			for _, e := range t.Elems {
+				visit(e)
+			}
+		case *Func:
+			for _, p := range t.Params {
+				visit(p)
+			}
+			visit(t.Result)
+		}
+	}
+	visit(k.x)
+	visit(k.y)
+	visit(k.result)
+	return found
+}
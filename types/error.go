@@ -0,0 +1,50 @@
+package types
+
+import (
+	"fmt"
+	"github.com/jonfk/calc/lex"
+	"sort"
+)
+
+// An Error describes a type error.
+// Pos is the position of the expression that caused it.
+type Error struct {
+	Pos lex.Pos
+	Msg string
+}
+
+func (e *Error) Error() string { return e.Msg }
+
+// ErrorList is a list of *Errors.
+// The zero value for an ErrorList is an empty ErrorList ready to use.
+type ErrorList []*Error
+
+// ErrorList implements the sort Interface.
+func (p ErrorList) Len() int           { return len(p) }
+func (p ErrorList) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p ErrorList) Less(i, j int) bool { return p[i].Pos < p[j].Pos }
+
+// Sort sorts an ErrorList by position.
+func (p ErrorList) Sort() {
+	sort.Stable(p)
+}
+
+// An ErrorList implements the error interface.
+func (p ErrorList) Error() string {
+	switch len(p) {
+	case 0:
+		return "no errors"
+	case 1:
+		return p[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", p[0], len(p)-1)
+}
+
+// Err returns an error equivalent to this error list.
+// If the list is empty, Err returns nil.
+func (p ErrorList) Err() error {
+	if len(p) == 0 {
+		return nil
+	}
+	return p
+}
@@ -0,0 +1,185 @@
+package types
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// A Type is the static type of an expression.
+type Type interface {
+	String() string
+}
+
+// Basic is the type of literal values.
+type Basic int
+
+// The list of basic types. Invalid is the type of erroneous
+// expressions; no errors are reported for operations on it, so that
+// each mistake is reported once.
+const (
+	Invalid Basic = iota
+	Int
+	Float
+	Bool
+	String
+	Char
+	Complex
+)
+
+var basicStrings = [...]string{
+	Invalid: "invalid",
+	Int:     "int",
+	Float:   "float",
+	Bool:    "bool",
+	String:  "string",
+	Char:    "char",
+	Complex: "complex",
+}
+
+func (b Basic) String() string { return basicStrings[b] }
+
+type (
+	// A Tuple is the type of a tuple expression.
+	Tuple struct {
+		Elems []Type
+	}
+
+	// A Func is the type of a function.
+	Func struct {
+		Params []Type
+		Result Type
+	}
+
+	// A Var is a type variable, standing for a type that is not known
+	// yet. Inference binds it to a type once the way the typed value
+	// is used determines one. A Var left unbound after checking means
+	// that any type is accepted, as for the parameter of
+	//
+	//	def id(x) = x end
+	//
+	// whose type is func('a) 'a. A numeric variable, such as the type
+	// of x in x + 1, can only stand for int, float or complex.
+	Var struct {
+		id      int
+		level   int  // let-nesting depth at which the variable was created
+		numeric bool // the variable stands for int, float or complex
+		bound   Type // type the variable stands for; or nil
+	}
+)
+
+func (t *Tuple) String() string { return typeString(t) }
+func (t *Func) String() string  { return typeString(t) }
+func (t *Var) String() string   { return typeString(t) }
+
+// typeString formats t, naming its unbound type variables 'a, 'b, ...
+// in the order they appear.
+func typeString(t Type) string {
+	var buf bytes.Buffer
+	writeType(&buf, t, make(map[*Var]string))
+	return buf.String()
+}
+
+func writeType(buf *bytes.Buffer, t Type, names map[*Var]string) {
+	switch t := t.(type) {
+	case Basic:
+		buf.WriteString(t.String())
+	case *Tuple:
+		buf.WriteByte('(')
+		writeTypeList(buf, t.Elems, names)
+		buf.WriteByte(')')
+	case *Func:
+		buf.WriteString("func(")
+		writeTypeList(buf, t.Params, names)
+		buf.WriteString(") ")
+		writeType(buf, t.Result, names)
+	case *Var:
+		if t.bound != nil {
+			writeType(buf, t.bound, names)
+			return
+		}
+		name, ok := names[t]
+		if !ok {
+			n := len(names)
+			name = "'" + string(rune('a'+n%26))
+			if n >= 26 {
+				name += strconv.Itoa(n / 26)
+			}
+			names[t] = name
+		}
+		buf.WriteString(name)
+	default:
+		buf.WriteString("?")
+	}
+}
+
+func writeTypeList(buf *bytes.Buffer, list []Type, names map[*Var]string) {
+	for i, t := range list {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		writeType(buf, t, names)
+	}
+}
+
+// prune returns the type a chain of bound type variables stands for.
+func prune(t Type) Type {
+	for {
+		v, ok := t.(*Var)
+		if !ok || v.bound == nil {
+			return t
+		}
+		t = v.bound
+	}
+}
+
+// resolve returns t with every bound type variable in it, however
+// deeply nested, replaced by the type it stands for.
+func resolve(t Type) Type {
+	switch t := prune(t).(type) {
+	case *Tuple:
+		elems := make([]Type, len(t.Elems))
+		for i, e := range t.Elems {
+			elems[i] = resolve(e)
+		}
+		return &Tuple{elems}
+	case *Func:
+		params := make([]Type, len(t.Params))
+		for i, p := range t.Params {
+			params[i] = resolve(p)
+		}
+		return &Func{params, resolve(t.Result)}
+	default:
+		return t
+	}
+}
+
+// Identical reports whether x and y are the same type. Unbound type
+// variables are only identical to themselves.
+func Identical(x, y Type) bool {
+	x, y = prune(x), prune(y)
+	switch x := x.(type) {
+	case *Tuple:
+		y, ok := y.(*Tuple)
+		return ok && identicalList(x.Elems, y.Elems)
+	case *Func:
+		y, ok := y.(*Func)
+		return ok && identicalList(x.Params, y.Params) && Identical(x.Result, y.Result)
+	}
+	return x == y
+}
+
+func identicalList(x, y []Type) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	for i := range x {
+		if !Identical(x[i], y[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isNumeric(t Type) bool {
+	return t == Int || t == Float || t == Complex
+}
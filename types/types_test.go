@@ -0,0 +1,332 @@
+package types
+
+import (
+	"github.com/jonfk/calc/ast"
+	"github.com/jonfk/calc/lex"
+	"github.com/jonfk/calc/parse"
+	"strings"
+	"testing"
+)
+
+// checkString parses and checks input with a fresh Checker and returns
+// the type of its last statement if it is an expression.
+func checkString(t *testing.T, input string) (Type, error) {
+	parser := parse.Parse("test", input)
+	if len(parser.Errors) > 0 {
+		t.Fatalf("%q: unexpected syntax error: %s", input, parser.Errors)
+	}
+	c := New()
+	err := c.CheckFile(parser.File)
+	list := parser.File.List
+	if s, ok := list[len(list)-1].(*ast.ExprStmt); ok {
+		return c.Types[s.X], err
+	}
+	return nil, err
+}
+
+func TestInfer(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`1 + 2 * 3`, "int"},
+		{`1 + 2.5`, "float"},
+		{`7 / 2 < 3.5`, "bool"},
+		{`"a" + "b"`, "string"},
+		{`'a' < 'b'`, "bool"},
+		{`true == !false && 1 != 2`, "bool"},
+		{`-2.5`, "float"},
+		{`2 ** 3 div 2`, "int"},
+		{`2 ** 0.5`, "float"},
+		{`1 + 2i`, "complex"},
+		{`2.5 * 1i == 1`, "bool"},
+		{`(real(1i), abs(1i), abs(-1), conj(2))`, "(float, float, int, complex)"},
+		{`((real)(1i), (abs)(-1))`, "(float, int)"},
+		{"val f = imag\nf(2)", "float"},
+		{"val z: complex = 1.5\nz", "complex"},
+		{"def f(a, b) = a * b end\nf(1i, 2)", "complex"},
+		{`1 << 2 | 3 & 4 ^ 5 >> 1`, "int"},
+		{`fn (x, y) => x div y end`, "func(int, int) int"},
+		{`fn (x) => x & 1 end`, "func(int) int"},
+		{`(1, ("a", 'c'))`, "(int, (string, char))"},
+		{`if true then 1 else 2 end`, "int"},
+		{`let val a = 1; val b = "s" in (b, a) end`, "(string, int)"},
+		{`fn (x, y) => x + y end`, "func('a, 'b) 'c"},
+		{`fn (x) => x + 1 end`, "func('a) 'b"},
+		{`fn (x) => if x then "a" else "b" end end`, "func(bool) string"},
+		{`fn (x, y) => (y, x) end`, "func('a, 'b) ('b, 'a)"},
+		{`fn (s) => s + "!" end`, "func(string) string"},
+		{`fn (f) => f(1) end`, "func(func(int) 'a) 'a"},
+		{`def id(x) = x end`, ""},
+		{"def id(x) = x end\n(id(1), id(\"a\"))", "(int, string)"},
+		{"val id = fn (x) => x end\n(id(1), id('c'))", "(int, char)"},
+		{"def fact(n) = if n <= 1 then 1 else n * fact(n - 1) end end\nfact(10)", "int"},
+		{"def add(a, b) = a + b end\nadd(1, 2)", "int"},
+		{"def add(a, b) = a + b end\nadd(1, 2.5)", "float"},
+		{"def add(a, b) = a + b end\nadd(\"a\", \"b\")", "string"},
+		{"val (a, (b, c)) = (1, (2.5, \"s\"))\n(c, b, a)", "(string, float, int)"},
+		{"val t = (1, 2)\nlen(t) + len(\"abc\")", "int"},
+		{`char(int('a') + 1)`, "char"},
+		{"val len = fn (x) => x + 1 end\nlen(1)", "int"},
+	}
+	for _, test := range tests {
+		typ, err := checkString(t, test.input)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", test.input, err)
+			continue
+		}
+		got := ""
+		if typ != nil {
+			got = typ.String()
+		}
+		if got != test.expected {
+			t.Errorf("%q:\nExpected: %s\nGot:      %s", test.input, test.expected, got)
+		}
+	}
+}
+
+func TestTypeErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		msg   string
+	}{
+		{`true + 1`, "1:6: invalid operation: operator + not defined on bool and int"},
+		{`if 3 then 1 else 2 end`, "1:4: non-bool condition of type int in if expression"},
+		{`if true then 1 else "a" end`, "1:1: mismatched types int and string of if expression branches"},
+		{`"a" - "b"`, "1:5: invalid operation: operator - not defined on string and string"},
+		{`'a' + 'b'`, "1:5: invalid operation: operator + not defined on char and char"},
+		{`true < false`, "1:6: invalid operation: operator < not defined on bool and bool"},
+		{`(1, 2) + 1`, "1:8: invalid operation: operator + not defined on (int, int) and int"},
+		{`(fn (x) => x + 1 end) - 1`, "1:23: invalid operation: operator - not defined on func('a) 'b and int"},
+		{`1.5 div 2`, "1:5: invalid operation: operator div not defined on float and int"},
+		{`1 | true`, "1:3: invalid operation: operator | not defined on int and bool"},
+		{`fn (x) => if x then x << 1 else 0 end end`, "1:23: invalid operation: operator << not defined on bool and int"},
+		{`1i < 2`, "1:4: invalid operation: operator < not defined on complex and int"},
+		{`1i % 2`, "1:4: invalid operation: operator % not defined on complex and int"},
+		{`real("a")`, "1:6: invalid argument of type string for real"},
+		{`(real)("x")`, "1:8: invalid argument of type string for real"},
+		{`(abs)("x")`, "1:7: invalid argument of type string for abs"},
+		{`val f = abs`, "1:9: builtin abs must be called"},
+		{"val f = conj\nf(\"x\")", "2:3: cannot use string value as numeric argument in call to f"},
+		{"val x: float = 1i", "1:16: cannot use complex value as float in declaration"},
+		{`def f(x) = (-x) + "s" end`, "1:17: invalid operation: operator + not defined on 'a and string"},
+		{`def f(x) = -x + "s" end`, "1:15: invalid operation: operator + not defined on 'a and string"},
+		{`!1`, "1:1: invalid operation: operator ! not defined on int"},
+		{`-"a"`, "1:1: invalid operation: operator - not defined on string"},
+		{`1 && true`, "1:1: operator && requires bool operands, have int"},
+		{`undefinedName + 1`, "1:1: undeclared name: undefinedName"},
+		{`()`, "1:1: empty parenthesized expression has no value"},
+		{`len(3)`, "1:5: invalid argument of type int for len"},
+		{`len(1, 2)`, "1:1: wrong number of arguments in call to len: have 2, want 1"},
+		{`int(1.5)`, "1:5: cannot convert value of type float to int"},
+		{`char("a")`, "1:6: cannot convert value of type string to char"},
+		{"val (a, b) = 1", "1:5: cannot destructure int value into 2 names"},
+		{"def f(x) = let val (a, b) = abs(x) in a end end", "1:20: cannot destructure 'a value into 2 names"},
+		{"def f(x) = x(x) end", "1:12: cannot call non-function value of type 'a"},
+		{"def f(x) = (abs(x))(2) end", "1:12: cannot call non-function value of type 'a"},
+		{"val (a, b) = (1, 2, 3)", "1:5: tuple pattern has 2 elements but value of type (int, int, int) has 3"},
+		{"var x = 1\nx = 2.5", "2:5: cannot assign float value to x of type int"},
+		{"y = 1", "1:1: undeclared name: y"},
+		{"val x = 1\nx = 2", "2:1: cannot assign to val x"},
+		{"def f(x) = x end\nf = 2", "2:1: cannot assign to func f"},
+		{"len = 1", "1:1: cannot assign to func len"},
+		{"def f(x) = x end\nf(1, 2)", "2:1: wrong number of arguments in call to f: have 2, want 1"},
+		{"def f(x) = if x then 1 else 2 end end\nf(1)", "2:3: cannot use int value as bool argument in call to f"},
+		{"def f(x) = x + 1 end\nf(\"s\")", "2:3: cannot use string value as numeric argument in call to f"},
+		{"val x = 1\nx(2)", "2:1: cannot call non-function value of type int"},
+		{"def f(x) = if x then x + 1 else 0 end end", "1:24: invalid operation: operator + not defined on bool and int"},
+		{"def add(a, b) = a + b end\nadd(true, 1)", "2:1: invalid operation: operator + not defined on bool and int in add"},
+		{"def add(a, b) = a + b end\nadd(1, 2) && true", "2:1: operator && requires bool operands, have int"},
+		{"def f(x) = f(x, 1) end", "1:12: wrong number of arguments in call to f: have 2, want 1"},
+	}
+	for _, test := range tests {
+		_, err := checkString(t, test.input)
+		if err == nil {
+			t.Errorf("%q: expected error %q", test.input, test.msg)
+			continue
+		}
+		e := err.(ErrorList)[0]
+		pos := lex.NewFileSet().AddFile("test", -1, len(test.input))
+		pos.SetLinesForContent(test.input)
+		if got := pos.Position(e.Pos).String()[len("test:"):] + ": " + e.Msg; got != test.msg {
+			t.Errorf("%q:\nExpected: %s\nGot:      %s", test.input, test.msg, got)
+		}
+	}
+}
+
+func TestAnnotations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"val x: int = 3\nx", "int"},
+		{"val s: string = \"a\"\ns", "string"},
+		{"val t: (int, (string, char)) = (1, (\"a\", 'b'))\nt", "(int, (string, char))"},
+		{"val (a, b): (bool, char) = (true, 'c')\n(b, a)", "(char, bool)"},
+		{"def f(a: int, b: int): int = a + b end\nf", "func(int, int) int"},
+		{"def f(s: string) = s end\nf", "func(string) string"},
+		{"val f = fn (x: bool): bool => !x end\nf", "func(bool) bool"},
+		{"def f(a: int, b) = (a, b) end\nf", "func(int, 'a) (int, 'a)"},
+		{"def pair(x): (int, int) = (x, x) end\npair", "func(int) (int, int)"},
+	}
+	for _, test := range tests {
+		typ, err := checkString(t, test.input)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", test.input, err)
+			continue
+		}
+		if typ.String() != test.expected {
+			t.Errorf("%q:\nExpected: %s\nGot:      %s", test.input, test.expected, typ)
+		}
+	}
+}
+
+// TestWidening documents where an int is widened to a float: only where
+// a float is expected by an annotation or a float var, never in the
+// other direction and never between the branches of an if expression.
+func TestWidening(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // type of the last expression; or error
+	}{
+		// declarations annotated as float, also within tuples
+		{"val x: float = 3\nx", "float"},
+		{"val t: (float, int) = (1, 2)\nt", "(float, int)"},
+		{"val (a, b): (float, float) = (1, 2.5)\na + b", "float"},
+		// parameters and results annotated as float
+		{"def half(x: float) = x / 2 end\nhalf(3)", "float"},
+		{"def three(): float = 3 end\nthree()", "float"},
+		{"val f = fn (x: float): float => x end\nf(1)", "float"},
+		// assignment to a float var
+		{"var x = 1.5\nx = 2\nx", "float"},
+		{"var x: float = 0\nx = x + 1\nx", "float"},
+		// arithmetic on an int and a float is float arithmetic
+		{"1 + 2.5", "float"},
+		// no narrowing
+		{"val x: int = 2.5", "cannot use float value as int in declaration"},
+		{"def f(x: int) = x end\nf(1.5)", "cannot use float value as int argument in call to f"},
+		{"def f(): int = 1.5 end", "cannot use float value as int result"},
+		{"var x = 1\nx = 2.5", "cannot assign float value to x of type int"},
+		// no widening without an expected float
+		{"if true then 1 else 2.0 end", "mismatched types int and float of if expression branches"},
+		{"val x: string = 1", "cannot use int value as string in declaration"},
+		{"val t: (float, float) = (1, \"a\")", "cannot use (int, string) value as (float, float) in declaration"},
+		{"val t: (int, int) = (1, 2, 3)", "cannot use (int, int, int) value as (int, int) in declaration"},
+		{"val x: number = 1", "unknown type number"},
+	}
+	for _, test := range tests {
+		typ, err := checkString(t, test.input)
+		got := ""
+		switch {
+		case err != nil:
+			got = err.(ErrorList)[0].Msg
+		case typ != nil:
+			got = typ.String()
+		}
+		if got != test.expected {
+			t.Errorf("%q:\nExpected: %s\nGot:      %s", test.input, test.expected, got)
+		}
+	}
+}
+
+func TestCheckFileReportsAllErrors(t *testing.T) {
+	_, err := checkString(t, "true + 1\nval x = 1 + \"a\"\nx + 1\n!2")
+	list, ok := err.(ErrorList)
+	if !ok || len(list) != 3 {
+		t.Fatalf("Expected 3 errors, got %v", err)
+	}
+	for i := 1; i < len(list); i++ {
+		if list[i-1].Pos > list[i].Pos {
+			t.Errorf("errors are not sorted: %s before %s", list[i-1].Msg, list[i].Msg)
+		}
+	}
+}
+
+func TestCheckStmt(t *testing.T) {
+	c := New()
+	steps := []struct {
+		input    string
+		expected string // type; or error message prefix
+		fails    bool
+	}{
+		{"def twice(f, x) = f(f(x)) end", "", false},
+		{"twice(fn (s) => s + \"!\" end, \"a\")", "string", false},
+		{"val bad = true + 1", "invalid operation", true},
+		{"bad", "undeclared name: bad", true},
+		{"var n = 0", "", false},
+		{"n = n + 1", "", false},
+		{"n = \"s\"", "cannot assign string value to n of type int", true},
+	}
+	for _, step := range steps {
+		parser := parse.Parse("test", step.input)
+		typ, err := c.CheckStmt(parser.File.List[0])
+		switch {
+		case step.fails && (err == nil || !strings.HasPrefix(err.Error(), step.expected)):
+			t.Errorf("%q: expected error %q, got %v", step.input, step.expected, err)
+		case !step.fails && err != nil:
+			t.Errorf("%q: unexpected error: %s", step.input, err)
+		case !step.fails && step.expected == "" && typ != nil:
+			t.Errorf("%q: expected no type, got %s", step.input, typ)
+		case !step.fails && step.expected != "" && (typ == nil || typ.String() != step.expected):
+			t.Errorf("%q: expected %s, got %v", step.input, step.expected, typ)
+		}
+	}
+}
+
+// TestTypesMap checks that a valid type is recorded for every
+// expression and that declared objects get their types.
+func TestTypesMap(t *testing.T) {
+	input := `val pi = 3.14
+def area(r) = pi * r * r end
+val (a, b) = (area(2), "circle")
+var n = len(b)
+n = n + 1
+let val half = fn (x) => x / 2 end in half(a) end
+if n > 3 then (a, b) else (0.5, "") end
+`
+	parser := parse.Parse("test", input)
+	types, err := Check(parser.File)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	count := 0
+	ast.Inspect(parser.File, func(n ast.Node) bool {
+		x, ok := n.(ast.Expr)
+		if !ok {
+			return true
+		}
+		count++
+		typ, ok := types[x]
+		if !ok {
+			t.Errorf("no type recorded for %s", ast.Sprint(x))
+		} else if typ == Invalid {
+			t.Errorf("invalid type recorded for %s", ast.Sprint(x))
+		}
+		return true
+	})
+	if count == 0 {
+		t.Fatal("no expressions found")
+	}
+
+	objects := map[string]string{
+		"pi":   "float",
+		"area": "func('a) 'b",
+		"a":    "float",
+		"b":    "string",
+		"n":    "int",
+	}
+	for name, expected := range objects {
+		obj := parser.File.Scope.Lookup(name)
+		if obj == nil {
+			t.Errorf("%s not declared", name)
+			continue
+		}
+		if typ, ok := obj.Type.(Type); !ok || typ.String() != expected {
+			t.Errorf("%s: expected type %s, got %v", name, expected, obj.Type)
+		}
+	}
+	last := parser.File.List[len(parser.File.List)-1].(*ast.ExprStmt)
+	if typ := types[last.X].String(); typ != "(float, string)" {
+		t.Errorf("Expected (float, string), got %s", typ)
+	}
+}